@@ -11,13 +11,74 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/arch/x86/x86asm"
 	"io"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 )
 
 type CompileUnit struct {
+	name      string
+	producer  string
+	inlined   bool
 	functions []*Function
+
+	// lowpc is the base address of location list, addrBase is the offset of its addresses in .debug_addr
+	lowpc    uint64
+	addrBase uint64
+
+	// version is the DWARF version of unit, the location lists of DWARF 5 are in .debug_loclists, or in .debug_loc.
+	// loclistsBase is the offsets table of DW_FORM_loclistx in .debug_loclists
+	version      int
+	dwarf64      bool
+	loclistsBase uint64
+}
+
+// unitHeader is the header of unit in .debug_info, which isn't exported by debug/dwarf
+type unitHeader struct {
+	version int
+	dwarf64 bool
+}
+
+// parseUnitHeaders return the headers of units in .debug_info by the offsets of their first entries
+func parseUnitHeaders(info []byte) map[dwarf.Offset]unitHeader {
+	headers := make(map[dwarf.Offset]unitHeader)
+	for off := uint64(0); off+4 <= uint64(len(info)); {
+		var (
+			header  unitHeader
+			length  = uint64(binary.LittleEndian.Uint32(info[off:]))
+			start   = off + 4
+			offsize = uint64(4)
+		)
+		if length == 0xffffffff {
+			if start+8 > uint64(len(info)) {
+				break
+			}
+			length = binary.LittleEndian.Uint64(info[start:])
+			start += 8
+			header.dwarf64, offsize = true, 8
+		}
+		next := start + length
+		if start+2 > uint64(len(info)) || next > uint64(len(info)) {
+			break
+		}
+		header.version = int(binary.LittleEndian.Uint16(info[start:]))
+		// version, abbrev offset and address size, DWARF 5 has the unit type and its own fields
+		size := 2 + offsize + 1
+		if header.version >= 5 {
+			size++
+			switch info[start+2] {
+			case DW_UT_skeleton, DW_UT_split_compile:
+				size += 8
+			case DW_UT_type, DW_UT_split_type:
+				size += 8 + offsize
+			}
+		}
+		headers[dwarf.Offset(start+size)] = header
+		off = next
+	}
+	return headers
 }
 
 type Function struct {
@@ -28,8 +89,37 @@ type Function struct {
 	declFile  int64
 	external  bool
 
-	variables []*dwarf.Entry
+	variables []*localVariable
 	cu        *CompileUnit
+	// inlinedCalls are the functions inlined in the function, the nested call follows its caller
+	inlinedCalls []*inlinedCall
+}
+
+// inlinedCall is the instance of function which is inlined by the compiler, it's described by TagInlinedSubroutine
+type inlinedCall struct {
+	name     string
+	ranges   [][2]uint64
+	callLine int64
+	// depth is the nesting of inlined calls, the call in the function directly is 0
+	depth int
+}
+
+// localVariable is the variable or the parameter of function
+type localVariable struct {
+	entry *dwarf.Entry
+	name  string
+	// ranges is the pc ranges of the innermost lexical block, it's nil when the variable is in the whole function
+	ranges [][2]uint64
+	// depth is the nesting of lexical blocks, the inner variable shadows the outer one
+	depth    int
+	declLine int64
+	isArg    bool
+}
+
+// openEntry is the entry whose children are being parsed
+type openEntry struct {
+	tag    dwarf.Tag
+	ranges [][2]uint64
 }
 
 type BI struct {
@@ -37,8 +127,40 @@ type BI struct {
 	Functions         []*Function
 	CompileUnits      []*CompileUnit
 	FramesInformation []*VirtualUnwindFrameInformation
+	// ehFrame is the .eh_frame of C code and external linker, it's searched if .debug_frame doesn't cover the pc
+	ehFrame *ehFrame
+	// Globals are the package variables, like `runtime.allgs`
+	Globals map[string]*dwarf.Entry
+
+	dwarfData *dwarf.Data
+	// runtimeTypes maps the offset of `runtime._type` from typesStart to the DWARF type, it's used by interface
+	runtimeTypes map[uint64]dwarf.Offset
+	typesStart   uint64
+	// pie is true for the position-independent executable, its addresses are moved by staticBase after loading
+	pie bool
+	// entry is the entry point in ELF header, staticBase is the load bias, it's 0 before the process is started
+	entry      uint64
+	staticBase uint64
+	// tlsSize is the size of PT_TLS segment aligned by its alignment, it's used by DW_OP_form_tls_address
+	tlsSize uint64
+	// prologueEnds are the sorted addresses marked by PrologueEnd in line table, they are collected at the first use
+	prologueEnds []uint64
+	// lineTable is the rows of all line tables sorted by address, it's built at the first use
+	lineTable []*dwarf.LineEntry
+	// Types maps the go name of type to its DWARF entry, like `*main.Point`
+	Types map[string]dwarf.Offset
+
+	// loc, loclists and addr are the sections of location lists, which describe the variables of optimized binary
+	loc      []byte
+	loclists []byte
+	addr     []byte
+	// unitHeaders are the headers of units in .debug_info, they are used while the compile units are parsed
+	unitHeaders map[dwarf.Offset]unitHeader
 }
 
+// DW_AT_go_runtime_type is the offset of `runtime._type` from `runtime.types`, it's produced by go linker
+const AttrGoRuntimeType dwarf.Attr = 0x2904
+
 func analyze(execfile string) (*BI, error) {
 	var (
 		elffile   *elf.File
@@ -61,16 +183,52 @@ func analyze(execfile string) (*BI, error) {
 	}
 
 	// parse
-	bi = &BI{Sources: make(map[string]map[int][]*dwarf.LineEntry)}
+	bi = &BI{
+		Sources:      make(map[string]map[int][]*dwarf.LineEntry),
+		Globals:      make(map[string]*dwarf.Entry),
+		runtimeTypes: make(map[uint64]dwarf.Offset),
+		Types:        make(map[string]dwarf.Offset),
+	}
 	if dwarfData, err = elffile.DWARF(); err != nil {
 		return nil, err
 	}
+	bi.dwarfData = dwarfData
+	bi.pie, bi.entry = elffile.Type == elf.ET_DYN, elffile.Entry
+	for _, prog := range elffile.Progs {
+		if prog.Type == elf.PT_TLS {
+			bi.tlsSize = prog.Memsz
+			if prog.Align > 1 {
+				bi.tlsSize = (prog.Memsz + prog.Align - 1) / prog.Align * prog.Align
+			}
+		}
+	}
+	if bi.loc, err = openDebugSection(elffile, ".debug_loc"); err != nil {
+		return nil, err
+	}
+	if bi.loclists, err = openDebugSection(elffile, ".debug_loclists"); err != nil {
+		return nil, err
+	}
+	if bi.addr, err = openDebugSection(elffile, ".debug_addr"); err != nil {
+		return nil, err
+	}
+	info, err := openDebugSection(elffile, ".debug_info")
+	if err != nil {
+		return nil, err
+	}
+	bi.unitHeaders = parseUnitHeaders(info)
 	if err = bi.ParseLineAndInfoSection(dwarfData); err != nil {
 		return nil, err
 	}
 	if err = bi.ParseFrameSection(elffile); err != nil {
 		return nil, err
 	}
+	if symbols, err := elffile.Symbols(); err == nil {
+		for _, symbol := range symbols {
+			if symbol.Name == "runtime.types" {
+				bi.typesStart = symbol.Value
+			}
+		}
+	}
 
 	// debug source log
 	for file, mp := range bi.Sources {
@@ -145,6 +303,7 @@ func (bi *BI) ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 		curSubProgramEntry  *dwarf.Entry
 		curCompileUnitEntry *dwarf.Entry
 		dwarfReader         *dwarf.Reader
+		openEntries         []openEntry
 	)
 	dwarfReader = dwarfData.Reader()
 	for {
@@ -154,9 +313,36 @@ func (bi *BI) ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 		if curEntry == nil {
 			break
 		}
+		// the null entry ends the children of the last open entry
+		if curEntry.Tag == 0 {
+			if len(openEntries) > 0 {
+				openEntries = openEntries[:len(openEntries)-1]
+			}
+			continue
+		}
+		if curEntry.Children {
+			open := openEntry{tag: curEntry.Tag}
+			if curEntry.Tag == dwarf.TagLexDwarfBlock {
+				if open.ranges, err = dwarfData.Ranges(curEntry); err != nil {
+					return err
+				}
+			}
+			openEntries = append(openEntries, open)
+		}
 
 		if curEntry.Tag == dwarf.TagCompileUnit {
 			curCompileUnit = &CompileUnit{}
+			curCompileUnit.name, _ = curEntry.Val(dwarf.AttrName).(string)
+			curCompileUnit.producer, _ = curEntry.Val(dwarf.AttrProducer).(string)
+			curCompileUnit.lowpc, _ = curEntry.Val(dwarf.AttrLowpc).(uint64)
+			if addrBase, ok := curEntry.Val(dwarf.AttrAddrBase).(int64); ok {
+				curCompileUnit.addrBase = uint64(addrBase)
+			}
+			if loclistsBase, ok := curEntry.Val(dwarf.AttrLoclistsBase).(int64); ok {
+				curCompileUnit.loclistsBase = uint64(loclistsBase)
+			}
+			header := bi.unitHeaders[curEntry.Offset]
+			curCompileUnit.version, curCompileUnit.dwarf64 = header.version, header.dwarf64
 			bi.CompileUnits = append(bi.CompileUnits, curCompileUnit)
 
 			fields := curEntry.Field
@@ -185,6 +371,10 @@ func (bi *BI) ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 			if lineReader, err = dwarfData.LineReader(curEntry); err != nil {
 				return err
 			}
+			if lineReader == nil {
+				curCompileUnitEntry = curEntry
+				continue
+			}
 			lineEntry = &dwarf.LineEntry{}
 			cuname, _ := curEntry.Val(dwarf.AttrName).(string)
 			for {
@@ -231,6 +421,10 @@ func (bi *BI) ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 					if val, ok := field.Val.(uint64); ok {
 						curFunction.highpc = val
 					}
+					// DWARF 4 and later, the high pc of class constant is the offset from the low pc
+					if val, ok := field.Val.(int64); ok && field.Class == dwarf.ClassConstant {
+						curFunction.highpc = curFunction.lowpc + uint64(val)
+					}
 				case dwarf.AttrFrameBase:
 					if val, ok := field.Val.([]byte); ok {
 						curFunction.frameBase = val
@@ -243,6 +437,13 @@ func (bi *BI) ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 					if val, ok := field.Val.(bool); ok {
 						curFunction.external = val
 					}
+				case dwarf.AttrAbstractOrigin:
+					// the out-of-line instance of inlined function has no name
+					if curFunction.name == "" {
+						if curFunction.name, err = abstractOriginName(dwarfData, curEntry); err != nil {
+							return err
+						}
+					}
 				default:
 					logger.Debug("analyze:TagSubprogram unknow attr", zap.Any("field", field))
 				}
@@ -257,6 +458,31 @@ func (bi *BI) ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 			curSubProgramEntry = curEntry
 		}
 
+		if off, ok := curEntry.Val(AttrGoRuntimeType).(uint64); ok && off != 0 {
+			bi.runtimeTypes[off] = curEntry.Offset
+		}
+
+		switch curEntry.Tag {
+		case dwarf.TagBaseType, dwarf.TagPointerType, dwarf.TagStructType, dwarf.TagTypedef,
+			dwarf.TagArrayType, dwarf.TagSubroutineType:
+			if name, ok := curEntry.Val(dwarf.AttrName).(string); ok {
+				if _, ok = bi.Types[name]; !ok {
+					bi.Types[name] = curEntry.Offset
+				}
+			}
+		}
+
+		if curEntry.Tag == dwarf.TagInlinedSubroutine && curCompileUnit != nil {
+			curCompileUnit.inlined = true
+			if curFunction != nil {
+				call, err := newInlinedCall(dwarfData, curEntry, openEntries)
+				if err != nil {
+					return err
+				}
+				curFunction.inlinedCalls = append(curFunction.inlinedCalls, call)
+			}
+		}
+
 		/*curEntry.Tag == dwarf.TagArrayType ||
 		curEntry.Tag == dwarf.TagBaseType ||
 		curEntry.Tag == dwarf.TagClassType ||
@@ -264,8 +490,14 @@ func (bi *BI) ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 		curEntry.Tag == dwarf.TagConstType ||
 		curEntry.Tag == dwarf.TagPointerType ||
 		curEntry.Tag == dwarf.TagStringType */
-		if curEntry.Tag == dwarf.TagVariable {
-			curFunction.variables = append(curFunction.variables, curEntry)
+		// the package variable is located by the absolute address, it's behind the functions of compile unit
+		if loc, ok := curEntry.Val(dwarf.AttrLocation).([]byte); ok && curEntry.Tag == dwarf.TagVariable &&
+			len(loc) > 0 && loc[0] == DW_OP_addr {
+			if name, ok := curEntry.Val(dwarf.AttrName).(string); ok {
+				bi.Globals[name] = curEntry
+			}
+		} else if lv, ok := newLocalVariable(curEntry, openEntries); ok && curFunction != nil {
+			curFunction.variables = append(curFunction.variables, lv)
 			logger.Debug("|================= START ===========================|")
 			fields := curEntry.Field
 			for _, field := range fields {
@@ -283,6 +515,319 @@ func (bi *BI) ParseLineAndInfoSection(dwarfData *dwarf.Data) error {
 	return nil
 }
 
+// newInlinedCall return the inlined instance of function, its name is in the abstract origin
+func newInlinedCall(dwarfData *dwarf.Data, entry *dwarf.Entry, openEntries []openEntry) (*inlinedCall, error) {
+	var err error
+	call := &inlinedCall{}
+	call.callLine, _ = entry.Val(dwarf.AttrCallLine).(int64)
+	if call.ranges, err = dwarfData.Ranges(entry); err != nil {
+		return nil, err
+	}
+	if call.name, err = abstractOriginName(dwarfData, entry); err != nil {
+		return nil, err
+	}
+	for _, open := range openEntries {
+		if open.tag == dwarf.TagInlinedSubroutine {
+			call.depth++
+		}
+	}
+	// the open entries include the entry itself if it has children
+	if entry.Children {
+		call.depth--
+	}
+	return call, nil
+}
+
+// abstractOriginName return the name of the abstract instance which the entry refers to
+func abstractOriginName(dwarfData *dwarf.Data, entry *dwarf.Entry) (string, error) {
+	off, ok := entry.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+	if !ok {
+		return "", nil
+	}
+	reader := dwarfData.Reader()
+	reader.Seek(off)
+	origin, err := reader.Next()
+	if err != nil {
+		return "", err
+	}
+	if origin == nil {
+		return "", fmt.Errorf("can't find the abstract origin at 0x%x", off)
+	}
+	name, _ := origin.Val(dwarf.AttrName).(string)
+	return name, nil
+}
+
+// inlinedCallsAt return the inlined calls containing pc, from the outermost to the innermost
+func (fn *Function) inlinedCallsAt(pc uint64) []*inlinedCall {
+	var calls []*inlinedCall
+	for _, call := range fn.inlinedCalls {
+		if call.depth == len(calls) && rangesContain(call.ranges, pc) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// newLocalVariable return the variable declared in function or its lexical blocks.
+// The parameters of inlined function are ignored, they are the children of TagInlinedSubroutine.
+func newLocalVariable(entry *dwarf.Entry, openEntries []openEntry) (*localVariable, bool) {
+	if entry.Tag != dwarf.TagVariable && entry.Tag != dwarf.TagFormalParameter {
+		return nil, false
+	}
+	name, ok := entry.Val(dwarf.AttrName).(string)
+	if !ok {
+		return nil, false
+	}
+	lv := &localVariable{entry: entry, name: strings.TrimPrefix(name, "&"), isArg: entry.Tag == dwarf.TagFormalParameter}
+	lv.declLine, _ = entry.Val(dwarf.AttrDeclLine).(int64)
+	for i := len(openEntries) - 1; i >= 0; i-- {
+		switch openEntries[i].tag {
+		case dwarf.TagLexDwarfBlock:
+			// the ranges are copied, they are relocated per variable
+			if lv.ranges == nil {
+				lv.ranges = append([][2]uint64(nil), openEntries[i].ranges...)
+			}
+			lv.depth++
+		case dwarf.TagSubprogram:
+			return lv, true
+		default:
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+// scopeVariables return the variables visible at pc and line of the function.
+// The variable which isn't declared yet is hidden, and the shadowed one is replaced by the inner variable.
+func (fn *Function) scopeVariables(pc uint64, line int) []*localVariable {
+	visible := make(map[string]int, len(fn.variables))
+	vars := make([]*localVariable, 0, len(fn.variables))
+	for _, lv := range fn.variables {
+		if !lv.isArg && lv.declLine > int64(line) {
+			continue
+		}
+		if lv.ranges != nil && !rangesContain(lv.ranges, pc) {
+			continue
+		}
+		if i, ok := visible[lv.name]; ok {
+			if old := vars[i]; old.depth > lv.depth || (old.depth == lv.depth && old.declLine > lv.declLine) {
+				continue
+			}
+			vars[i] = lv
+			continue
+		}
+		visible[lv.name] = len(vars)
+		vars = append(vars, lv)
+	}
+	return vars
+}
+
+func rangesContain(ranges [][2]uint64, pc uint64) bool {
+	for _, r := range ranges {
+		if r[0] <= pc && pc < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// optimized reports whether the compiler optimized the compile unit or inlined functions into it,
+// just like `-gcflags all=-N -l` is missing. The runtime and its internal packages are always compiled with
+// optimizations, and the units of C or assembly in cgo binaries aren't compiled by Go, so they are ignored.
+func (cu *CompileUnit) optimized() bool {
+	if cu.name == "runtime" || strings.HasPrefix(cu.name, "runtime/") || strings.HasPrefix(cu.name, "internal/") {
+		return false
+	}
+	flags, ok := goCompilerFlags(cu.producer)
+	if !ok {
+		return false
+	}
+	var noopt, noinline bool
+	for _, flag := range flags {
+		switch flag {
+		case "-N":
+			noopt = true
+		case "-l":
+			noinline = true
+		}
+	}
+	return !noopt || !noinline || cu.inlined
+}
+
+// goCompilerFlags return the flags of the producer like `Go cmd/compile go1.22.1; -N -l regabi`,
+// ok is false if the producer isn't the Go compiler
+func goCompilerFlags(producer string) ([]string, bool) {
+	if !strings.HasPrefix(producer, "Go cmd/compile") {
+		return nil, false
+	}
+	i := strings.Index(producer, ";")
+	if i < 0 {
+		return nil, true
+	}
+	return strings.Fields(producer[i+1:]), true
+}
+
+// optimizedCompileUnits return the names of compile units which are optimized or contain inlined functions
+func (bi *BI) optimizedCompileUnits() []string {
+	names := make([]string, 0)
+	existed := make(map[string]bool)
+	for _, cu := range bi.CompileUnits {
+		if cu.optimized() && !existed[cu.name] {
+			existed[cu.name] = true
+			names = append(names, cu.name)
+		}
+	}
+	return names
+}
+
+// findGlobalVariable return the address and the type of package variable
+func (bi *BI) findGlobalVariable(name string) (uint64, dwarf.Type, error) {
+	entry, ok := bi.Globals[name]
+	if !ok {
+		return 0, nil, fmt.Errorf("can't find variable %s", name)
+	}
+	loc, _ := entry.Val(dwarf.AttrLocation).([]byte)
+	if len(loc) != 9 {
+		return 0, nil, fmt.Errorf("unsupported location %v of variable %s", loc, name)
+	}
+	typ, err := bi.entryType(entry)
+	if err != nil {
+		return 0, nil, err
+	}
+	return binary.LittleEndian.Uint64(loc[1:]) + bi.staticBase, typ, nil
+}
+
+// globalNames return the sorted names of package variables matching re
+func (bi *BI) globalNames(re *regexp.Regexp) []string {
+	names := make([]string, 0)
+	for name := range bi.Globals {
+		if re.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// entryType return the type of variable entry
+func (bi *BI) entryType(entry *dwarf.Entry) (dwarf.Type, error) {
+	off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+	if !ok {
+		return nil, errors.New("can't find the type of variable")
+	}
+	return bi.dwarfData.Type(off)
+}
+
+// runtimeTypeToDwarf return the DWARF type of `runtime._type` at addr
+func (bi *BI) runtimeTypeToDwarf(addr uint64) (dwarf.Type, error) {
+	off, ok := bi.runtimeTypes[addr-bi.typesStart]
+	if !ok {
+		return nil, fmt.Errorf("can't find the type of runtime._type 0x%x", addr)
+	}
+	return bi.dwarfData.Type(off)
+}
+
+// findType return the type by the go name
+func (bi *BI) findType(name string) (dwarf.Type, error) {
+	off, ok := bi.Types[name]
+	if !ok {
+		return nil, fmt.Errorf("can't find type %s", name)
+	}
+	return bi.dwarfData.Type(off)
+}
+
+// resolveTypedef return the underlying type of the named type
+func resolveTypedef(typ dwarf.Type) dwarf.Type {
+	for {
+		td, ok := typ.(*dwarf.TypedefType)
+		if !ok {
+			return typ
+		}
+		typ = td.Type
+	}
+}
+
+// structField return the field of struct by name
+func structField(st *dwarf.StructType, name string) (*dwarf.StructField, error) {
+	for _, field := range st.Field {
+		if field.Name == name {
+			return field, nil
+		}
+	}
+	return nil, fmt.Errorf("can't find field %s in %s", name, st.StructName)
+}
+
+// findFunction return the function by the full name, like `main.add` or `main.(*Point).Scale`
+func (bi *BI) findFunction(name string) *Function {
+	for _, f := range bi.Functions {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// findFunctionByName finds the function by the full name like `main.handler`, or the suffix after the package
+// like `(*Server).ServeHTTP` and `pkg/path.Func`. The name should match only one function.
+func (bi *BI) findFunctionByName(name string) (*Function, error) {
+	var matched []*Function
+	for _, f := range bi.Functions {
+		// the abstract instance of inlined function has no code
+		if f.name == name && f.lowpc < f.highpc {
+			return f, nil
+		}
+		if f.lowpc < f.highpc && (strings.HasSuffix(f.name, "."+name) || strings.HasSuffix(f.name, "/"+name)) {
+			matched = append(matched, f)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("can't find function %s", name)
+	case 1:
+		return matched[0], nil
+	}
+	names := make([]string, 0, len(matched))
+	for _, f := range matched {
+		names = append(names, f.name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("function %s is ambiguous: %s", name, strings.Join(names, ", "))
+}
+
+// functionsMatching return the functions whose names match re, the functions without code are skipped
+func (bi *BI) functionsMatching(re *regexp.Regexp) []*Function {
+	var fns []*Function
+	for _, f := range bi.Functions {
+		if f.lowpc < f.highpc && re.MatchString(f.name) {
+			fns = append(fns, f)
+		}
+	}
+	sort.Slice(fns, func(i, j int) bool { return fns[i].name < fns[j].name })
+	return fns
+}
+
+// functionBreakPointPc return the address after the prologue of function, it's marked by PrologueEnd in line table.
+// The function without prologue stops at its entry.
+func (bi *BI) functionBreakPointPc(f *Function) uint64 {
+	if bi.prologueEnds == nil {
+		for _, lines := range bi.Sources {
+			for _, entries := range lines {
+				for _, entry := range entries {
+					if entry.PrologueEnd {
+						bi.prologueEnds = append(bi.prologueEnds, entry.Address)
+					}
+				}
+			}
+		}
+		sort.Slice(bi.prologueEnds, func(i, j int) bool { return bi.prologueEnds[i] < bi.prologueEnds[j] })
+	}
+	i := sort.Search(len(bi.prologueEnds), func(i int) bool { return bi.prologueEnds[i] >= f.lowpc })
+	if i < len(bi.prologueEnds) && bi.prologueEnds[i] < f.highpc {
+		return bi.prologueEnds[i]
+	}
+	return f.lowpc
+}
+
 // not considered inline function
 func (bi *BI) findFunctionIncludePc(pc uint64) (*Function, error) {
 	for _, f := range bi.Functions {
@@ -293,6 +838,7 @@ func (bi *BI) findFunctionIncludePc(pc uint64) (*Function, error) {
 	return nil, &NotFoundFuncErr{pc: pc}
 }
 
+// ParseFrameSection parses .debug_frame (or .zdebug_frame) and .eh_frame, at least one of them should exist
 func (bi *BI) ParseFrameSection(elffile *elf.File) error {
 	var (
 		err          error
@@ -300,9 +846,20 @@ func (bi *BI) ParseFrameSection(elffile *elf.File) error {
 		frameData    []byte
 		frameInfo    *VirtualUnwindFrameInformation
 	)
+	if err = bi.parseEhFrameSection(elffile); err != nil {
+		return err
+	}
 	frameSection = elffile.Section(".debug_frame")
 	if frameSection == nil {
 		frameSection = elffile.Section(".zdebug_frame")
+	}
+	if frameSection == nil {
+		if bi.ehFrame == nil {
+			return errors.New("can't find the .debug_frame, .zdebug_frame or .eh_frame")
+		}
+		return nil
+	}
+	if frameSection.Name == ".zdebug_frame" {
 		sectionData := func(s *elf.Section) ([]byte, error) {
 			b, err := s.Data()
 			if err != nil && uint64(len(b)) < s.Size {
@@ -334,9 +891,6 @@ func (bi *BI) ParseFrameSection(elffile *elf.File) error {
 			return err
 		}
 	}
-	if frameSection == nil {
-		return errors.New("can'tt find the .debug_frame or .zdebug_frame")
-	}
 
 	buffer := bytes.NewBuffer(frameData)
 	var curCIE *CommonInformationEntry
@@ -346,6 +900,7 @@ func (bi *BI) ParseFrameSection(elffile *elf.File) error {
 				err = nil
 				break
 			}
+			return err
 		}
 		if bi.FramesInformation == nil {
 			bi.FramesInformation = make([]*VirtualUnwindFrameInformation, 0, 1)
@@ -356,16 +911,46 @@ func (bi *BI) ParseFrameSection(elffile *elf.File) error {
 		}
 		if frameInfo.FDE != nil {
 			frameInfo.FDE.CIE = curCIE
+			if curCIE != nil && curCIE.hasAugmentationData {
+				if err = skipAugmentationData(frameInfo.FDE); err != nil {
+					return err
+				}
+			}
 		}
 	}
 	return err
 }
 
+// parseEhFrameSection parses .eh_frame with the search table of .eh_frame_hdr, they are optional
+func (bi *BI) parseEhFrameSection(elffile *elf.File) error {
+	ehFrameSection := elffile.Section(".eh_frame")
+	if ehFrameSection == nil || ehFrameSection.Type == elf.SHT_NOBITS {
+		return nil
+	}
+	data, err := ehFrameSection.Data()
+	if err != nil {
+		return err
+	}
+	var (
+		hdr     []byte
+		hdrAddr uint64
+	)
+	if hdrSection := elffile.Section(".eh_frame_hdr"); hdrSection != nil && hdrSection.Type != elf.SHT_NOBITS {
+		if hdr, err = hdrSection.Data(); err != nil {
+			return err
+		}
+		hdrAddr = hdrSection.Addr
+	}
+	bi.ehFrame, err = newEhFrame(data, ehFrameSection.Addr, hdr, hdrAddr)
+	return err
+}
+
+// findFrameInformation executes the CIE and FDE instructions until pc, the rules of CFA and registers are in frame
 func (bi *BI) findFrameInformation(pc uint64) (*Frame, error) {
 	var fde *FrameDescriptionEntry
 	for index, frameInfo := range bi.FramesInformation {
 		if frameInfo.FDE != nil {
-			if frameInfo.FDE.begin <= pc && pc <= (frameInfo.FDE.begin+frameInfo.FDE.size) {
+			if frameInfo.FDE.begin <= pc && pc < (frameInfo.FDE.begin+frameInfo.FDE.size) {
 				//fde = frameInfo.FDE
 				//break
 				if fde == nil {
@@ -378,83 +963,17 @@ func (bi *BI) findFrameInformation(pc uint64) (*Frame, error) {
 			}
 		}
 	}
+	if fde == nil && bi.ehFrame != nil {
+		var err error
+		if fde, err = bi.ehFrame.findFDE(pc); err != nil {
+			return nil, err
+		}
+	}
 	if fde == nil {
 		return nil, fmt.Errorf("not find the frame cover pc = 0x%x", pc)
 	}
 
-	cie := fde.CIE
-	if cie == nil {
-		return nil, fmt.Errorf("fde.CIE should not be nil")
-	}
-
-	frame := &Frame{cie: cie, cfa: &DWRule{}, regsRule: make(map[uint64]DWRule)}
-	logger.Debug("========================= cie start\n")
-	if err := execCIEInstructions(frame, bytes.NewBuffer(cie.initial_instructions)); err != nil {
-		return nil, err
-	}
-	frame.loc = fde.begin
-	frame.address = pc
-	logger.Debug("========================= cie end\n")
-
-	logger.Debug("========================= fde.instructions start \n")
-	if err := execFDEInstructions(frame, bytes.NewBuffer(fde.instructions)); err != nil {
-		return nil, err
-	}
-	logger.Debug("========================= fde.instructions end \n")
-
-	var (
-		regs syscall.PtraceRegs
-		err  error
-	)
-	if regs, err = getRegisters(target.cmd); err != nil {
-		return nil, err
-	}
-
-	frame.regs = make([]uint64, 17)
-	frame.regs[16] = regs.PC()
-	frame.regs[7] = regs.Rsp
-	frame.regs[6] = regs.Rbp
-
-	logger.Debug("findFrameInformation",
-		zap.Any("regs", regs),
-		zap.Uint64("16", frame.regs[16]),
-		zap.Uint64("07", frame.regs[7]),
-		zap.Uint64("06", frame.regs[6]),
-	)
-
-	var framebase uint64
-	switch frame.cfa.rule {
-	case RuleCFA:
-		if frame.cfa.reg >= 17 {
-			return nil, fmt.Errorf("frame.cfa.reg >= 17")
-		}
-		if frame.regs[frame.cfa.reg] == 0 {
-			return nil, fmt.Errorf("rule.Reg is null")
-		}
-		reg := frame.regs[frame.cfa.reg]
-		framebase = reg + uint64(frame.cfa.offset)
-
-		logger.Debug("findFrameInformation",
-			zap.Uint64("frame.frambebase", frame.framebase),
-			zap.Int64("offset", frame.cfa.offset),
-			zap.Uint64("framebase", framebase))
-	/*case RuleOffset:
-	addr := frame.cfa.offset
-	buf := make([]byte, 8)
-	if _ ,err := syscall.PtracePeekData(cmd.Process.Pid, uintptr(addr), buf); err !=nil{
-		return nil, err
-	}
-	v := binary.LittleEndian.Uint64(buf)
-	frame.regs[7] = v
-	framebase = v*/
-
-	default:
-		return nil, fmt.Errorf("invalid cfa rule %v", frame.cfa.rule)
-	}
-
-	frame.framebase = framebase
-
-	return frame, nil
+	return fde.frameAt(pc)
 }
 
 func parseLoc(loc string) (string, int, error) {
@@ -485,30 +1004,109 @@ func (bi *BI) fileLineToPc(filename string, lineno int) (uint64, error) {
 	return bi.Sources[filename][lineno][0].Address, nil
 }
 
-func (bi *BI) fileLineToPcForBreakPoint(filename string, lineno int) (uint64, error) {
+// fileLineToPcsForBreakPoint return the addresses where the line should stop, the line may be emitted in several places,
+// like the inlined calls, the condition of loop and the deferred calls. Every block of the line in line table is a location,
+// the function declaration stops once after the prologue.
+func (bi *BI) fileLineToPcsForBreakPoint(filename string, lineno int) ([]uint64, error) {
 	if bi.Sources[filename] == nil || bi.Sources[filename][lineno] == nil || len(bi.Sources[filename][lineno]) == 0 {
-		return 0, NotFoundSourceLineErr
+		return nil, NotFoundSourceLineErr
 	}
-	lineEntryArray := bi.Sources[filename][lineno]
-	for _, v := range lineEntryArray {
+	prologueEnds := make(map[*Function]uint64)
+	for _, v := range bi.Sources[filename][lineno] {
 		if v.PrologueEnd {
-			return v.Address, nil
+			if f, err := bi.findFunctionIncludePc(v.Address); err == nil {
+				prologueEnds[f] = v.Address
+			}
 		}
 	}
-	addr := uint64(0)
-	for i, v := range lineEntryArray {
-		if i == 0 {
-			addr = v.Address
-		} else {
-			if addr > v.Address {
-				addr = v.Address
+
+	// the blocks without statement, like the jump out of if statement, are skipped unless all the blocks are
+	var (
+		pcs, stmtPcs  []uint64
+		inBlock, stmt bool
+	)
+	for _, v := range bi.sortedLineTable() {
+		if v.EndSequence || v.File == nil || v.File.Name != filename || v.Line != lineno {
+			if inBlock && stmt {
+				stmtPcs = append(stmtPcs, pcs[len(pcs)-1])
 			}
+			inBlock = false
+			continue
+		}
+		if !inBlock {
+			inBlock, stmt = true, v.IsStmt
+			pcs = append(pcs, v.Address)
+			continue
+		}
+		// the block stops at its first statement
+		if !stmt && v.IsStmt {
+			stmt = true
+			pcs[len(pcs)-1] = v.Address
 		}
 	}
-	if addr == 0 {
-		return 0, NotFoundSourceLineErr
+	if len(stmtPcs) > 0 {
+		pcs = stmtPcs
+	}
+
+	locations := make([]uint64, 0, len(pcs))
+	existed := make(map[uint64]bool, len(pcs))
+	for _, pc := range pcs {
+		if f, err := bi.findFunctionIncludePc(pc); err == nil {
+			if prologueEnd, ok := prologueEnds[f]; ok {
+				pc = prologueEnd
+			}
+		}
+		if pc != 0 && !existed[pc] {
+			existed[pc] = true
+			locations = append(locations, pc)
+		}
+	}
+	if len(locations) == 0 {
+		return nil, NotFoundSourceLineErr
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i] < locations[j] })
+	return locations, nil
+}
+
+// sortedLineTable return the rows of all line tables sorted by address.
+// The rows are shared with Sources, so they are relocated together.
+func (bi *BI) sortedLineTable() []*dwarf.LineEntry {
+	if bi.lineTable == nil {
+		for _, lines := range bi.Sources {
+			for _, entries := range lines {
+				bi.lineTable = append(bi.lineTable, entries...)
+			}
+		}
+		// the end of sequence is before the row of next sequence at the same address
+		sort.Slice(bi.lineTable, func(i, j int) bool {
+			a, b := bi.lineTable[i], bi.lineTable[j]
+			if a.Address != b.Address {
+				return a.Address < b.Address
+			}
+			if a.EndSequence != b.EndSequence {
+				return a.EndSequence
+			}
+			if a.File.Name != b.File.Name {
+				return a.File.Name < b.File.Name
+			}
+			return a.Line < b.Line
+		})
+	}
+	return bi.lineTable
+}
+
+// inlinedFunctionName return the function at pc like `main.leaf inlined in main.middle inlined in main.top`,
+// which tells the inlined instance of function
+func (bi *BI) inlinedFunctionName(pc uint64) string {
+	f, err := bi.findFunctionIncludePc(pc)
+	if err != nil {
+		return ""
+	}
+	name := f.name
+	for _, call := range f.inlinedCallsAt(pc) {
+		name = call.name + " inlined in " + name
 	}
-	return addr, nil
+	return name
 }
 
 func (bi *BI) getCurFileLineByPtracePc() (string, int, error) {
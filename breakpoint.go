@@ -4,22 +4,121 @@ import (
 	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	"go/constant"
+	"go/parser"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 	"syscall"
 )
 
+// BInfo is the breakpoint instruction written at pc, the user breakpoint may own several of them
 type BInfo struct {
 	original []byte
 	filename string
 	lineno   int
 	pc       uint64
 	kind     BPKIND
+	// logical is the user breakpoint which owns the location, it's nil for internal breakpoint
+	logical *BreakPoint
+	// function is the function at pc, the inlined function is printed with its callers
+	function string
+}
+
+// enabled reports whether the instruction at pc is replaced by the breakpoint
+func (info *BInfo) enabled() bool {
+	return info.logical == nil || !info.logical.disabled
+}
+
+// BreakPoint is the user breakpoint printed by `bl`, the line emitted in several places has a location for each of them,
+// like the inlined calls and the condition of loop
+type BreakPoint struct {
+	// id is the number of user breakpoint in `bl`, it isn't changed when others are cleared
+	id       int
+	filename string
+	lineno   int
+	// cond is the go expression of conditional breakpoint, the process stops only when it's true
+	cond string
+	// hits counts the stops whose condition is true, the first ignore hits and the hits not matching hitCond are passed
+	hits    int
+	ignore  int
+	hitCond *hitCondition
+	// temporary breakpoint is cleared after the first stop
+	temporary bool
+	// disabled breakpoint keeps the original instructions in memory until it's enabled
+	disabled  bool
+	locations []*BInfo
+}
+
+// locationID return the id of location like `1.2`, the breakpoint with one location is printed by its id
+func (b *BreakPoint) locationID(info *BInfo) string {
+	if len(b.locations) == 1 {
+		return strconv.Itoa(b.id)
+	}
+	for i, v := range b.locations {
+		if v == info {
+			return fmt.Sprintf("%d.%d", b.id, i+1)
+		}
+	}
+	return strconv.Itoa(b.id)
+}
+
+// hitCondition is the predicate on the hit count, like `hits>=3`, `hits%2` is true on every second hit
+type hitCondition struct {
+	op string
+	n  int
+}
+
+// parseHitCondition parses the predicate like `hits>=3`, the operators are ==, !=, >=, <=, >, < and %
+func parseHitCondition(s string) (*hitCondition, error) {
+	if !strings.HasPrefix(s, "hits") {
+		return nil, fmt.Errorf("invalid hit condition `%s`", s)
+	}
+	rest := s[len("hits"):]
+	for _, op := range []string{"==", "!=", ">=", "<=", ">", "<", "%"} {
+		if !strings.HasPrefix(rest, op) {
+			continue
+		}
+		n, err := strconv.Atoi(rest[len(op):])
+		if err != nil || n < 0 || (op == "%" && n == 0) {
+			return nil, fmt.Errorf("invalid hit condition `%s`", s)
+		}
+		return &hitCondition{op: op, n: n}, nil
+	}
+	return nil, fmt.Errorf("invalid hit condition `%s`", s)
+}
+
+func (c *hitCondition) match(hits int) bool {
+	switch c.op {
+	case "==":
+		return hits == c.n
+	case "!=":
+		return hits != c.n
+	case ">=":
+		return hits >= c.n
+	case "<=":
+		return hits <= c.n
+	case ">":
+		return hits > c.n
+	case "<":
+		return hits < c.n
+	default:
+		return hits%c.n == 0
+	}
+}
+
+func (c *hitCondition) String() string {
+	return fmt.Sprintf("hits%s%d", c.op, c.n)
 }
 
 type BP struct {
 	infos []*BInfo
-	pid   int
+	// breakpoints are the user breakpoints, their locations are in infos
+	breakpoints []*BreakPoint
+	pid         int
+	// lastID is the id of the latest user breakpoint
+	lastID int
 }
 
 type BPKIND uint64
@@ -79,7 +178,60 @@ func (bp *BP) SetInternalBreakPoint(pid int, pc uint64) (*BInfo, error) {
 	return bInfo, nil
 }
 
-func (bp *BP) SetFileLineBreakPoint(bi *BI, pid int, filename string, lineno int) (*BInfo, error) {
+// SetBreakPoint sets the user breakpoint at loc, which is `file:line`, `:line` and `+N` in the file of selected frame,
+// `*0x4a1b20` for the address, or the function like `main.handler`, `(*Server).ServeHTTP` and `pkg/path.Func`
+func (bp *BP) SetBreakPoint(bi *BI, pid int, loc string) (*BreakPoint, error) {
+	switch {
+	case strings.HasPrefix(loc, "*"):
+		addr, err := strconv.ParseUint(loc[1:], 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %s", loc[1:])
+		}
+		if _, err = bi.findFunctionIncludePc(addr); err != nil {
+			return nil, err
+		}
+		filename, lineno, _ := bi.pcTofileLine(addr)
+		return bp.setUserBreakPoint(bi, pid, []uint64{addr}, filename, lineno)
+	case strings.HasPrefix(loc, "+") || strings.HasPrefix(loc, ":"):
+		n, err := strconv.Atoi(loc[1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid line %s", loc)
+		}
+		pc, err := target.selectedPc()
+		if err != nil {
+			return nil, err
+		}
+		filename, lineno, err := bi.pcTofileLine(pc)
+		if err != nil {
+			return nil, err
+		}
+		if loc[0] == '+' {
+			n += lineno
+		}
+		return bp.SetFileLineBreakPoint(bi, pid, filename, n)
+	}
+	if filename, lineno, err := parseLoc(loc); err == nil {
+		return bp.SetFileLineBreakPoint(bi, pid, filename, lineno)
+	}
+	f, err := bi.findFunctionByName(loc)
+	if err != nil {
+		return nil, err
+	}
+	return bp.SetFunctionBreakPoint(bi, pid, f)
+}
+
+// SetFunctionBreakPoint sets the user breakpoint after the prologue of function
+func (bp *BP) SetFunctionBreakPoint(bi *BI, pid int, f *Function) (*BreakPoint, error) {
+	pc := bi.functionBreakPointPc(f)
+	filename, lineno, err := bi.pcTofileLine(pc)
+	if err != nil {
+		return nil, err
+	}
+	return bp.setUserBreakPoint(bi, pid, []uint64{pc}, filename, lineno)
+}
+
+// SetFileLineBreakPoint sets the user breakpoint at every location of the line, the relative filename is in current directory
+func (bp *BP) SetFileLineBreakPoint(bi *BI, pid int, filename string, lineno int) (*BreakPoint, error) {
 	logger.Debug("SetFileLineBreakPoint", zap.String("filename", filename), zap.Int("lineno", lineno))
 	curDir, err := os.Getwd()
 	if err != nil {
@@ -87,50 +239,216 @@ func (bp *BP) SetFileLineBreakPoint(bi *BI, pid int, filename string, lineno int
 		return nil, err
 	}
 
-	fullfilename := path.Join(curDir, filename)
-	pc, err := bi.fileLineToPcForBreakPoint(fullfilename, lineno)
+	fullfilename := filename
+	if !path.IsAbs(filename) {
+		fullfilename = path.Join(curDir, filename)
+	}
+	pcs, err := bi.fileLineToPcsForBreakPoint(fullfilename, lineno)
 	if err != nil {
-		logger.Error("SetFileLineBreakPoint:fileLineToPc",
+		logger.Error("SetFileLineBreakPoint:fileLineToPcs",
 			zap.Error(err),
 			zap.Int(fullfilename, lineno))
 		return nil, err
 	}
-	logger.Debug("SetFileLineBreakPoint:fileLineToPc",
-		zap.Uint64("pc", pc),
+	logger.Debug("SetFileLineBreakPoint:fileLineToPcs",
+		zap.Uint64s("pcs", pcs),
 		zap.String("fullfilename", fullfilename),
 		zap.Int("lineno", lineno))
+	return bp.setUserBreakPoint(bi, pid, pcs, filename, lineno)
+}
 
-	var (
-		info     *BInfo
-		original []byte
-	)
-	if original, err = bp.setPcBreakPoint(pid, pc); err != nil {
-		logger.Error("SetFileLineBreakPoint",
-			zap.Error(err),
-			zap.Int("Pid", pid),
-			zap.String("fullfilename", fullfilename),
-			zap.Int("lineno", lineno))
-		return nil, err
+// setUserBreakPoint writes the breakpoint at pcs, filename and lineno are printed by `bl`.
+// The pc which has a breakpoint already is skipped, HasExistedBreakPointErr is returned if all of them are skipped.
+func (bp *BP) setUserBreakPoint(bi *BI, pid int, pcs []uint64, filename string, lineno int) (*BreakPoint, error) {
+	b := &BreakPoint{filename: filename, lineno: lineno}
+	for _, pc := range pcs {
+		original, err := bp.setPcBreakPoint(pid, pc)
+		if err == HasExistedBreakPointErr {
+			continue
+		}
+		if err != nil {
+			logger.Error("setUserBreakPoint",
+				zap.Error(err),
+				zap.Int("Pid", pid),
+				zap.Uint64("pc", pc),
+				zap.String("filename", filename),
+				zap.Int("lineno", lineno))
+			// the locations written already are restored
+			for _, info := range b.locations {
+				_ = bp.disableBreakPoint(pid, info)
+			}
+			return nil, err
+		}
+		info := &BInfo{original: original, filename: filename, lineno: lineno, pc: pc, kind: USERBPTYPE,
+			logical: b, function: bi.inlinedFunctionName(pc)}
+		b.locations = append(b.locations, info)
 	}
-	info = &BInfo{original: original, filename: filename, lineno: lineno, pc: pc, kind: USERBPTYPE}
-	bp.infos = append(bp.infos, info)
-
-	return info, err
+	if len(b.locations) == 0 {
+		return nil, HasExistedBreakPointErr
+	}
+	bp.lastID++
+	b.id = bp.lastID
+	bp.infos = append(bp.infos, b.locations...)
+	bp.breakpoints = append(bp.breakpoints, b)
+	return b, nil
 }
 
+// Continue resumes all threads of the process
 func (bp *BP) Continue(pid int) error {
-	return syscall.PtraceCont(pid, 0)
+	return target.resumeAllThreads()
 }
 
+// findBreakPoint return the enabled breakpoint at pc
 func (bp *BP) findBreakPoint(pc uint64) (*BInfo, bool) {
 	for _, v := range bp.infos {
-		if v.pc == pc {
+		if v.pc == pc && v.enabled() {
 			return v, true
 		}
 	}
 	return nil, false
 }
 
+// userBreakPoint return the user breakpoint by the id printed in `bl`
+func (bp *BP) userBreakPoint(id int) (*BreakPoint, error) {
+	for _, b := range bp.breakpoints {
+		if b.id == id {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("can't find breakpoint %d", id)
+}
+
+// clearUserBreakPoint deletes the user breakpoint and its locations, the pc is moved back if the current thread traps on it
+func (bp *BP) clearUserBreakPoint(pid int, b *BreakPoint) error {
+	if err := bp.disableUserBreakPoint(pid, b); err != nil {
+		return err
+	}
+	infos := make([]*BInfo, 0, len(bp.infos))
+	for _, v := range bp.infos {
+		if v.logical != b {
+			infos = append(infos, v)
+		}
+	}
+	bp.infos = infos
+	breakpoints := make([]*BreakPoint, 0, len(bp.breakpoints))
+	for _, v := range bp.breakpoints {
+		if v != b {
+			breakpoints = append(breakpoints, v)
+		}
+	}
+	bp.breakpoints = breakpoints
+	return nil
+}
+
+// disableUserBreakPoint restores the original instructions until the breakpoint is enabled,
+// the pc is moved back if the current thread traps on it
+func (bp *BP) disableUserBreakPoint(pid int, b *BreakPoint) error {
+	if b.disabled {
+		return nil
+	}
+	pc, err := getPtracePc()
+	if err != nil {
+		return err
+	}
+	for _, info := range b.locations {
+		if err = bp.disableBreakPoint(pid, info); err != nil {
+			return err
+		}
+	}
+	b.disabled = true
+	for _, info := range b.locations {
+		if pc-1 == info.pc {
+			return setPcRegister(target.cmd, info.pc)
+		}
+	}
+	return nil
+}
+
+// enableUserBreakPoint writes the breakpoints again, their original instructions are kept by writeMemory
+func (bp *BP) enableUserBreakPoint(pid int, b *BreakPoint) error {
+	if !b.disabled {
+		return nil
+	}
+	for _, info := range b.locations {
+		if err := bp.enableBreakPoint(pid, info); err != nil {
+			return err
+		}
+	}
+	b.disabled = false
+	return nil
+}
+
+// checkCondition checks the syntax of condition, the empty cond means no condition
+func checkCondition(cond string) error {
+	if cond == "" {
+		return nil
+	}
+	if _, err := parser.ParseExpr(cond); err != nil {
+		return fmt.Errorf("invalid condition `%s`: %s", cond, err.Error())
+	}
+	return nil
+}
+
+// shouldStop checks the user breakpoint which the current thread traps on, the process is resumed again if it's false.
+// The hit is counted when the condition is true, then the ignore count and the hit condition are checked.
+// The temporary breakpoint is cleared when the process stops on it. The location of user breakpoint is returned.
+func (bp *BP) shouldStop(pid int) (*BInfo, bool, error) {
+	pc, err := getPtracePc()
+	if err != nil {
+		return nil, true, err
+	}
+	info, ok := bp.findBreakPoint(pc - 1)
+	if !ok || info.logical == nil {
+		return nil, true, nil
+	}
+	b := info.logical
+	if b.cond != "" {
+		ok, err := b.evalCondition()
+		if err != nil {
+			return info, true, fmt.Errorf("failed to evaluate the condition `%s` of breakpoint %s:%d: %s",
+				b.cond, b.filename, b.lineno, err.Error())
+		}
+		if !ok {
+			return info, false, nil
+		}
+	}
+	b.hits++
+	if b.ignore > 0 {
+		b.ignore--
+		return info, false, nil
+	}
+	if b.hitCond != nil && !b.hitCond.match(b.hits) {
+		return info, false, nil
+	}
+	if b.temporary {
+		// the temporary breakpoint isn't INTERNALBPTYPE, it has the id and is listed by `bl` like the other user breakpoints.
+		// clearInternalBreakPoint only drops the locations when the process restarts with the fresh instructions, but
+		// here the original instructions are restored, the pc is moved back and the id is removed by clearUserBreakPoint
+		return info, true, bp.clearUserBreakPoint(pid, b)
+	}
+	return info, true, nil
+}
+
+// evalCondition evaluates the condition in the innermost frame of the current thread
+func (b *BreakPoint) evalCondition() (bool, error) {
+	scope, err := newEvalScope(target.bi)
+	if err != nil {
+		return false, err
+	}
+	v, err := scope.evalString(b.cond)
+	if err != nil {
+		return false, err
+	}
+	value, err := v.constantValue()
+	if err != nil {
+		return false, err
+	}
+	if value.Kind() != constant.Bool {
+		return false, errors.New("the condition isn't boolean")
+	}
+	return constant.BoolVal(value), nil
+}
+
 func (bp *BP) enableBreakPoint(pid int, info *BInfo) error {
 	if info == nil {
 		return errors.New("enableBreakPoint breakpointinfo is null")
@@ -177,21 +495,8 @@ func (bp *BP) singleStepInstructionWithBreakpointCheck(pid int) error {
 		return err
 	}
 
-	if err = syscall.PtraceSingleStep(pid); err != nil {
-		return err
-	}
-	var s syscall.WaitStatus
-	if _, err = syscall.Wait4(pid, &s, syscall.WALL, nil); err != nil {
-		return err
-	}
-	if s.Exited() {
-		return nil
-	}
-	if s.StopSignal() == syscall.SIGTRAP {
-		return nil
-	}
-
-	return fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal())
+	_, err = target.stepThread(target.curTid())
+	return err
 }
 
 func (bp *BP) clearInternalBreakPoint(pc uint64) {
@@ -209,7 +514,7 @@ func (bp *BP) SetBpWhenRestart(pid int) error {
 		if v.kind == INTERNALBPTYPE {
 			bp.clearInternalBreakPoint(v.pc)
 		}
-		if v.kind == USERBPTYPE {
+		if v.kind == USERBPTYPE && v.enabled() {
 			if err := bp.enableBreakPoint(pid, v); err != nil {
 				return err
 			}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// the status in r12 when runtime.debugCallV2 traps, see the comments of debugCallV2 in runtime/asm_amd64.s
+const (
+	debugCallStatusCall    = 0
+	debugCallStatusReturn  = 1
+	debugCallStatusPanic   = 2
+	debugCallStatusFailed  = 8
+	debugCallStatusRestore = 16
+)
+
+// debugCallMinStack is the free stack required by runtime.debugCallV2
+const debugCallMinStack = 256
+
+// the integer registers of Go internal ABI on amd64 in order, there are 15 float registers X0 ... X14.
+// See https://go.dev/s/regabi
+var abiIntRegs = []string{"rax", "rbx", "rcx", "rdi", "rsi", "r8", "r9", "r10", "r11"}
+
+const abiFloatRegs = 15
+
+// abiPart is a part of the parameter passed by register, the integer or the float
+type abiPart struct {
+	offset, size int64
+	float        bool
+	reg          int
+}
+
+// abiParam is the parameter passed by registers, or on stack at offset of the argument frame
+type abiParam struct {
+	name   string
+	typ    dwarf.Type
+	inRegs bool
+	parts  []abiPart
+	offset int64
+}
+
+// abiAssigner assigns the registers to parameters one by one
+type abiAssigner struct {
+	ints, floats int
+	parts        []abiPart
+}
+
+// assign assigns registers to the value of typ, it return false when the registers aren't enough
+func (a *abiAssigner) assign(typ dwarf.Type, offset int64) bool {
+	switch typ := resolveTypedef(typ).(type) {
+	case *dwarf.FloatType:
+		return a.assignFloat(offset, typ.Size())
+	case *dwarf.ComplexType:
+		half := typ.Size() / 2
+		return a.assignFloat(offset, half) && a.assignFloat(offset+half, half)
+	case *dwarf.StructType:
+		// string, slice and interface are structs too
+		for _, field := range typ.Field {
+			if !a.assign(field.Type, offset+field.ByteOffset) {
+				return false
+			}
+		}
+		return true
+	case *dwarf.ArrayType:
+		switch typ.Count {
+		case 0:
+			return true
+		case 1:
+			return a.assign(typ.Type, offset)
+		}
+		return false
+	}
+	if a.ints == len(abiIntRegs) {
+		return false
+	}
+	a.parts = append(a.parts, abiPart{offset: offset, size: typ.Size(), reg: a.ints})
+	a.ints++
+	return true
+}
+
+func (a *abiAssigner) assignFloat(offset, size int64) bool {
+	if a.floats == abiFloatRegs {
+		return false
+	}
+	a.parts = append(a.parts, abiPart{offset: offset, size: size, float: true, reg: a.floats})
+	a.floats++
+	return true
+}
+
+// typeAlign return the alignment of typ on amd64
+func typeAlign(typ dwarf.Type) int64 {
+	switch typ := resolveTypedef(typ).(type) {
+	case *dwarf.StructType:
+		align := int64(1)
+		for _, field := range typ.Field {
+			if a := typeAlign(field.Type); a > align {
+				align = a
+			}
+		}
+		return align
+	case *dwarf.ArrayType:
+		return typeAlign(typ.Type)
+	case *dwarf.ComplexType:
+		return typ.Size() / 2
+	}
+	switch size := typ.Size(); {
+	case size > 8:
+		return 8
+	case size <= 0:
+		return 1
+	default:
+		return size
+	}
+}
+
+func alignUp(n, align int64) int64 {
+	return (n + align - 1) / align * align
+}
+
+// abiLayout assigns the arguments and the results by Go internal ABI.
+// The argument frame is the stack arguments, the stack results and the spill area of register arguments.
+func abiLayout(args, results []*abiParam) int64 {
+	offset := int64(0)
+	assign := func(params []*abiParam) {
+		a := &abiAssigner{}
+		for _, param := range params {
+			saved := *a
+			if a.assign(param.typ, 0) {
+				param.inRegs = true
+				param.parts = append([]abiPart(nil), a.parts[len(saved.parts):]...)
+				continue
+			}
+			*a = saved
+			a.parts = a.parts[:len(saved.parts)]
+			offset = alignUp(offset, typeAlign(param.typ))
+			param.offset = offset
+			offset += param.typ.Size()
+		}
+		offset = alignUp(offset, 8)
+	}
+	assign(args)
+	assign(results)
+	for _, param := range args {
+		if param.inRegs {
+			offset = alignUp(offset, typeAlign(param.typ)) + param.typ.Size()
+		}
+	}
+	return alignUp(offset, 8)
+}
+
+// callRegisters is the registers of the thread while calling function
+type callRegisters struct {
+	regs syscall.PtraceRegs
+	fp   []byte
+}
+
+func getCallRegisters(tid int) (*callRegisters, error) {
+	r := &callRegisters{fp: make([]byte, 512)}
+	if err := syscall.PtraceGetRegs(tid, &r.regs); err != nil {
+		return nil, err
+	}
+	if err := ptraceFpRegs(syscall.PTRACE_GETFPREGS, tid, r.fp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *callRegisters) set(tid int) error {
+	if err := syscall.PtraceSetRegs(tid, &r.regs); err != nil {
+		return err
+	}
+	return ptraceFpRegs(syscall.PTRACE_SETFPREGS, tid, r.fp)
+}
+
+// part return the bytes of register assigned to part, xmm registers are at offset 160 of `struct user_fpregs_struct`
+func (r *callRegisters) part(part abiPart) []byte {
+	if part.float {
+		return r.fp[160+part.reg*16 : 160+part.reg*16+int(part.size)]
+	}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, *registerFields(&r.regs)[abiIntRegs[part.reg]])
+	return buf[:part.size]
+}
+
+func (r *callRegisters) setPart(part abiPart, data []byte) {
+	if part.float {
+		reg := r.fp[160+part.reg*16 : 176+part.reg*16]
+		copy(reg, make([]byte, 16))
+		copy(reg, data)
+		return
+	}
+	buf := make([]byte, 8)
+	copy(buf, data)
+	*registerFields(&r.regs)[abiIntRegs[part.reg]] = binary.LittleEndian.Uint64(buf)
+}
+
+func ptraceFpRegs(request int, tid int, buf []byte) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, uintptr(request), uintptr(tid), 0, uintptr(unsafe.Pointer(&buf[0])), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// evalCallString evaluates `fn(args)` by calling the function in the process
+func (scope *evalScope) evalCallString(expr string) ([]*Variable, error) {
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	call, ok := node.(*ast.CallExpr)
+	if !ok {
+		return nil, fmt.Errorf("%s isn't a function call", expr)
+	}
+
+	fn, closure, receiver, err := scope.evalCallee(call.Fun)
+	if err != nil {
+		return nil, err
+	}
+	args, results, err := scope.bi.functionParams(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]*Variable, 0, len(call.Args)+1)
+	if receiver != nil {
+		values = append(values, receiver)
+	}
+	for _, arg := range call.Args {
+		v, err := scope.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	if len(values) != len(args) {
+		return nil, fmt.Errorf("%s needs %d arguments, but %d are given", fn.name, len(args), len(values))
+	}
+	data := make([][]byte, len(args))
+	for i, param := range args {
+		// the string constant is copied to the heap of process, like `call f("x")`
+		if v := values[i]; v.typ == nil && v.value != nil && v.value.Kind() == constant.String && typeName(param.typ) == "string" {
+			if values[i], err = target.allocString(constant.StringVal(v.value), param.typ); err != nil {
+				return nil, err
+			}
+		}
+		if data[i], err = values[i].assignableBytes(param.name, param.typ); err != nil {
+			return nil, err
+		}
+	}
+	return target.callFunction(fn, closure, args, data, results)
+}
+
+// functionParams return the arguments and the results of fn in order
+func (bi *BI) functionParams(fn *Function) ([]*abiParam, []*abiParam, error) {
+	var args, results []*abiParam
+	for _, lv := range fn.variables {
+		if !lv.isArg {
+			continue
+		}
+		typ, err := bi.entryType(lv.entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		param := &abiParam{name: lv.name, typ: typ}
+		if isResult, _ := lv.entry.Val(dwarf.AttrVarParam).(bool); isResult {
+			results = append(results, param)
+		} else {
+			args = append(args, param)
+		}
+	}
+	return args, results, nil
+}
+
+// evalCallee finds the function to call.
+// It's the function name like `main.add`, the method like `p.String`, or the variable of func type.
+func (scope *evalScope) evalCallee(node ast.Expr) (*Function, uint64, *Variable, error) {
+	name := typeExprName(node)
+	for _, fnName := range []string{name, scope.packageName() + "." + name} {
+		if fn := scope.bi.findFunction(fnName); fn != nil && name != "" {
+			return fn, 0, nil, nil
+		}
+	}
+
+	if sel, ok := node.(*ast.SelectorExpr); ok {
+		if receiver, err := scope.eval(sel.X); err == nil && receiver.typ != nil {
+			return scope.findMethod(receiver, sel.Sel.Name)
+		}
+	}
+
+	// the func value points to funcval, whose first word is the pc, it's passed in rdx as the closure context
+	v, err := scope.eval(node)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if _, ok := resolveTypedef(v.typ).(*dwarf.FuncType); !ok || v.typ == nil {
+		return nil, 0, nil, fmt.Errorf("%s isn't a function", name)
+	}
+	closure, err := v.uint()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if closure == 0 {
+		return nil, 0, nil, errors.New("call of nil function")
+	}
+	pc, err := target.readUint64(closure)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	fn, err := scope.bi.findFunctionIncludePc(pc)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return fn, closure, nil, nil
+}
+
+// findMethod finds the method of receiver, the receiver is dereferenced or addressed to match the method
+func (scope *evalScope) findMethod(receiver *Variable, method string) (*Function, uint64, *Variable, error) {
+	name := typeName(receiver.typ)
+	isPtr := strings.HasPrefix(name, "*")
+	name = strings.TrimPrefix(name, "*")
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return nil, 0, nil, fmt.Errorf("%s has no method %s", typeName(receiver.typ), method)
+	}
+	pkg, typ := name[:dot], name[dot+1:]
+
+	if fn := scope.bi.findFunction(fmt.Sprintf("%s.%s.%s", pkg, typ, method)); fn != nil {
+		if isPtr {
+			v, err := receiver.deref()
+			return fn, 0, v, err
+		}
+		return fn, 0, receiver, nil
+	}
+	if fn := scope.bi.findFunction(fmt.Sprintf("%s.(*%s).%s", pkg, typ, method)); fn != nil {
+		if isPtr {
+			return fn, 0, receiver, nil
+		}
+		v, err := scope.evalUnary(token.AND, receiver)
+		return fn, 0, v, err
+	}
+	return nil, 0, nil, fmt.Errorf("%s has no method %s", typeName(receiver.typ), method)
+}
+
+// callFunction calls fn in the goroutine of current thread by the protocol of runtime.debugCallV2.
+// Only the current thread is resumed during the call, so the function shouldn't wait for other goroutines.
+func (t *Target) callFunction(fn *Function, closure uint64, args []*abiParam, data [][]byte, results []*abiParam) ([]*Variable, error) {
+	debugCall := t.bi.findFunction("runtime.debugCallV2")
+	if debugCall == nil {
+		return nil, errors.New("can't find runtime.debugCallV2, call needs go1.17 or later")
+	}
+	if g := t.curGoroutine; g != nil && g.thread == nil {
+		return nil, fmt.Errorf("goroutine %d isn't running on any thread", g.id)
+	}
+	tid := t.curTid()
+	saved, err := getCallRegisters(tid)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.checkCallGoroutine(saved.regs.Rsp); err != nil {
+		return nil, err
+	}
+	frameSize := abiLayout(args, results)
+
+	// push the pc, and write the frame size at sp-16, then jump to debugCallV2.
+	// The pc is moved back if the thread traps on breakpoint, the runtime checks it's a safe point.
+	pc := saved.regs.Rip
+	if _, ok := t.bp.findBreakPoint(pc - 1); ok {
+		pc--
+	}
+	regs := *saved
+	regs.regs.Rsp -= 8
+	if err = t.writeUint64(regs.regs.Rsp, pc); err != nil {
+		return nil, err
+	}
+	if err = t.writeUint64(regs.regs.Rsp-16, uint64(frameSize)); err != nil {
+		return nil, err
+	}
+	regs.regs.Rip = debugCall.lowpc
+	if err = regs.set(tid); err != nil {
+		return nil, err
+	}
+
+	var (
+		values  []*Variable
+		callErr error
+	)
+	for {
+		cur, err := t.continueCall(tid)
+		if err != nil {
+			return nil, err
+		}
+		sp := cur.regs.Rsp
+		switch cur.regs.R12 {
+		case debugCallStatusCall:
+			// the arguments are written to the frame at sp and registers, then the function is called like CALL
+			for i, param := range args {
+				if !param.inRegs {
+					if err = t.writeMemory(sp+uint64(param.offset), data[i]); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				for _, part := range param.parts {
+					cur.setPart(part, data[i][part.offset:part.offset+part.size])
+				}
+			}
+			cur.regs.Rsp -= 8
+			if err = t.writeUint64(cur.regs.Rsp, cur.regs.Rip); err != nil {
+				return nil, err
+			}
+			cur.regs.Rip = fn.lowpc
+			cur.regs.Rdx = closure
+		case debugCallStatusReturn:
+			for _, param := range results {
+				v := &Variable{name: param.name, typ: param.typ}
+				if param.inRegs {
+					v.data = make([]byte, param.typ.Size())
+					for _, part := range param.parts {
+						copy(v.data[part.offset:], cur.part(part))
+					}
+				} else if v.data, err = t.readMemory(sp+uint64(param.offset), int(param.typ.Size())); err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+			}
+		case debugCallStatusPanic:
+			// the panic value is `interface {}` at sp
+			typ, err := t.bi.findType("interface {}")
+			if err != nil {
+				return nil, err
+			}
+			callErr = fmt.Errorf("panic: %s", newVariable("", sp, typ).format(loadConfig))
+		case debugCallStatusFailed:
+			// the reason is the string at sp
+			reason := "unknown reason"
+			if header, err := t.readMemory(sp, 16); err == nil {
+				if buf, err := t.readMemory(binary.LittleEndian.Uint64(header), int(binary.LittleEndian.Uint64(header[8:]))); err == nil {
+					reason = string(buf)
+				}
+			}
+			callErr = fmt.Errorf("can't call function: %s", reason)
+		case debugCallStatusRestore:
+			// all registers except rip and rsp are restored, the runtime reloads the pointers which may be moved
+			// by stack copying, then pops its frame and returns to pc
+			restore := *saved
+			restore.regs.Rip, restore.regs.Rsp = cur.regs.Rip, cur.regs.Rsp
+			if err = restore.set(tid); err != nil {
+				return nil, err
+			}
+			if err = t.stepInstructionOut(tid, debugCall); err != nil {
+				return nil, err
+			}
+			// the thread trapped on breakpoint is stopped after the INT3 as before
+			if pc != saved.regs.Rip {
+				if err = setPcRegister(t.cmd, saved.regs.Rip); err != nil {
+					return nil, err
+				}
+			}
+			// the threads created during the call are stopped too
+			if err = t.stopAllThreads(); err != nil {
+				return nil, err
+			}
+			return values, callErr
+		default:
+			return nil, fmt.Errorf("unknown status %d of runtime.debugCallV2", cur.regs.R12)
+		}
+		if err = cur.set(tid); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// stepInstructionOut single steps the thread until it returns from fn
+func (t *Target) stepInstructionOut(tid int, fn *Function) error {
+	for {
+		if exited, err := t.stepThread(tid); err != nil {
+			return err
+		} else if exited {
+			return errors.New("the process has exited during the call")
+		}
+		var regs syscall.PtraceRegs
+		if err := syscall.PtraceGetRegs(tid, &regs); err != nil {
+			return err
+		}
+		if regs.Rip < fn.lowpc || regs.Rip >= fn.highpc {
+			return nil
+		}
+	}
+}
+
+// checkCallGoroutine checks the goroutine on current thread is running, and has enough stack for debugCallV2
+func (t *Target) checkCallGoroutine(sp uint64) error {
+	gs, err := t.goroutines()
+	if err != nil {
+		return err
+	}
+	for _, g := range gs {
+		if g.thread != t.curThread {
+			continue
+		}
+		if g.status&^gScan != gRunning {
+			return fmt.Errorf("goroutine %d is %s, the function can be called in running goroutine", g.id, g.statusString())
+		}
+		if sp < g.stackLo+debugCallMinStack {
+			return fmt.Errorf("goroutine %d has no enough stack to call function", g.id)
+		}
+		return nil
+	}
+	return errors.New("there is no goroutine running on current thread")
+}
+
+// continueCall resumes the current thread until it traps on INT3 of debugCallV2.
+// The breakpoints in the called function are stepped over.
+func (t *Target) continueCall(tid int) (*callRegisters, error) {
+	sig := 0
+	for {
+		if err := syscall.PtraceCont(tid, sig); err != nil {
+			return nil, err
+		}
+		sig = 0
+		var s syscall.WaitStatus
+		if _, err := syscall.Wait4(tid, &s, syscall.WALL, nil); err != nil {
+			return nil, err
+		}
+		if s.Exited() || s.Signaled() {
+			return nil, errors.New("the process has exited during the call")
+		}
+		if !s.Stopped() {
+			continue
+		}
+		if isClone, err := t.handleCloneEvent(tid, s); isClone {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch s.StopSignal() {
+		case syscall.SIGTRAP:
+			regs, err := getCallRegisters(tid)
+			if err != nil {
+				return nil, err
+			}
+			info, ok := t.bp.findBreakPoint(regs.regs.Rip - 1)
+			if !ok {
+				return regs, nil
+			}
+			if err = t.stepOverBreakPoint(tid, info); err != nil {
+				return nil, err
+			}
+		case syscall.SIGSTOP:
+		default:
+			sig = int(s.StopSignal())
+		}
+	}
+}
+
+// stepOverBreakPoint executes the original instruction of breakpoint which the thread traps on
+func (t *Target) stepOverBreakPoint(tid int, info *BInfo) error {
+	pid := t.cmd.Process.Pid
+	if err := t.bp.disableBreakPoint(pid, info); err != nil {
+		return err
+	}
+	defer t.bp.enableBreakPoint(pid, info)
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(tid, &regs); err != nil {
+		return err
+	}
+	regs.SetPC(info.pc)
+	if err := syscall.PtraceSetRegs(tid, &regs); err != nil {
+		return err
+	}
+	if err := syscall.PtraceSingleStep(tid); err != nil {
+		return err
+	}
+	var s syscall.WaitStatus
+	_, err := syscall.Wait4(tid, &s, syscall.WALL, nil)
+	return err
+}
+
+// allocString allocates the memory by calling runtime.mallocgc, then writes s to it
+func (t *Target) allocString(s string, typ dwarf.Type) (*Variable, error) {
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(s)))
+	if len(s) == 0 {
+		return &Variable{typ: typ, data: header}, nil
+	}
+	fn := t.bi.findFunction("runtime.mallocgc")
+	if fn == nil {
+		return nil, errors.New("can't find runtime.mallocgc to allocate string")
+	}
+	args, results, err := t.bi.functionParams(fn)
+	if err != nil {
+		return nil, err
+	}
+	// mallocgc(size uintptr, typ *_type, needzero bool) unsafe.Pointer
+	if len(args) != 3 || len(results) != 1 {
+		return nil, errors.New("unexpected signature of runtime.mallocgc")
+	}
+	size := make([]byte, 8)
+	binary.LittleEndian.PutUint64(size, uint64(len(s)))
+	values, err := t.callFunction(fn, 0, args, [][]byte{size, make([]byte, 8), {1}}, results)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := values[0].uint()
+	if err != nil {
+		return nil, err
+	}
+	if err = t.writeMemory(addr, []byte(s)); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(header, addr)
+	return &Variable{typ: typ, data: header}, nil
+}
@@ -41,6 +41,10 @@ const (
 	DW_CFA_lo_user = 0x1c
 	DW_CFA_hi_user = 0x3f
 
+	// GNU extensions
+	DW_CFA_GNU_args_size                = 0x2e // ULEB128 size
+	DW_CFA_GNU_negative_offset_extended = 0x2f // ULEB128 register, ULEB128 offset
+
 	// Opcodes that take an addend operand.
 	DW_CFA_advance_loc = 0x1 << 6 // +delta
 	DW_CFA_offset      = 0x2 << 6 // +register (ULEB128 offset)
@@ -67,102 +71,238 @@ type DWRule struct {
 	offset int64
 	reg    uint64
 	rule   Rule
+	// expression is the DWARF expression of RuleExpression and RuleValExpression
+	expression []byte
+}
+
+// frameState is saved by DW_CFA_remember_state
+type frameState struct {
+	cfa      DWRule
+	regsRule map[uint64]DWRule
+}
+
+func copyRules(rules map[uint64]DWRule) map[uint64]DWRule {
+	res := make(map[uint64]DWRule, len(rules))
+	for reg, rule := range rules {
+		res[reg] = rule
+	}
+	return res
 }
 
 func execSingleInstruction(frame *Frame, buf *bytes.Buffer) error {
 	var (
-		byte byte
-		err  error
+		op  byte
+		err error
 	)
 
-	if byte, err = buf.ReadByte(); err != nil {
+	if op, err = buf.ReadByte(); err != nil {
 		return err
 	}
-	switch byte & high_2_bits {
+	switch op & high_2_bits {
 	case DW_CFA_advance_loc:
-		byte = DW_CFA_advance_loc
+		op = DW_CFA_advance_loc
 		if err = buf.UnreadByte(); err != nil {
 			return err
 		}
 	case DW_CFA_offset:
-		byte = DW_CFA_offset
+		op = DW_CFA_offset
 		if err = buf.UnreadByte(); err != nil {
 			return err
 		}
 	case DW_CFA_restore:
-		byte = DW_CFA_restore
+		op = DW_CFA_restore
 		if err = buf.UnreadByte(); err != nil {
 			return err
 		}
 	}
 
-	switch byte {
-	case DW_CFA_offset_extended:
-		reg, _, _ := DecodeULEB128(buf)
-		offset, _, _ := DecodeULEB128(buf)
-		frame.regsRule[reg] = DWRule{offset: int64(offset) * frame.cie.data_alignment_factor, rule: RuleOffset}
-		logger.Debug(fmt.Sprintf("DW_CFA_offset_extended, reg %d, offset %d, dwrule.offset %d\n", reg, offset, frame.regsRule[reg].offset))
-	case DW_CFA_def_cfa:
-		frame.cfa.reg, _, _ = DecodeULEB128(buf)
-		offset, _, _ := DecodeULEB128(buf)
-		frame.cfa.offset = int64(offset)
-		frame.cfa.rule = RuleCFA
-		logger.Debug(fmt.Sprintf("DW_CFA_def_cfa, reg %d, offset %d\n", frame.cfa.reg, frame.cfa.offset))
-	case DW_CFA_def_cfa_register:
-		reg, _, _ := DecodeULEB128(buf)
-		frame.cfa.reg = reg
-		frame.cfa.rule = RuleUndefined
-		logger.Debug(fmt.Sprintf("DW_CFA_def_cfa_register, cfa.reg %d, cfa.offset %d\n", reg, frame.cfa.offset))
-	case DW_CFA_def_cfa_offset_sf:
-		offset, _, _ := DecodeSLEB128(buf)
-		t := offset
-		offset *= frame.cie.data_alignment_factor
-		frame.cfa.offset = offset
-		logger.Debug(fmt.Sprintf("DW_CFA_def_cfa_offset_sf, offset *= frame.data_aligment_factor, %d = %d * %d\n",
-			offset, t, frame.cie.data_alignment_factor))
+	uleb := func() uint64 {
+		n, _, _ := DecodeULEB128(buf)
+		return n
+	}
+	sleb := func() int64 {
+		n, _, _ := DecodeSLEB128(buf)
+		return n
+	}
+	block := func() []byte {
+		return append([]byte(nil), buf.Next(int(uleb()))...)
+	}
+	daf := frame.cie.data_alignment_factor
+	caf := frame.cie.code_alignment_factor
+
+	switch op {
+	case DW_CFA_nop:
+		return nil
+	case DW_CFA_set_loc:
+		// the address is encoded like the initial location of FDE, which is the absolute address in .debug_frame
+		var pos, loc uint64
+		fde := frame.fde
+		if fde != nil && fde.instructionsAddr != 0 {
+			pos = fde.instructionsAddr + uint64(len(fde.instructions)-buf.Len())
+		}
+		if loc, err = readEncodedPointer(buf, frame.cie.fdeEncoding, pos, 0); err != nil {
+			return err
+		}
+		if frame.cie.fdeEncoding&0x70 != DW_EH_PE_pcrel && fde != nil {
+			loc += fde.staticBase
+		}
+		frame.loc = loc
 	case DW_CFA_advance_loc:
-		if byte, err = buf.ReadByte(); err != nil {
+		if op, err = buf.ReadByte(); err != nil {
 			return err
 		}
-		delta := byte & low_6_offset
-		frame.loc += uint64(delta) * frame.cie.code_alignment_factor
+		delta := op & low_6_offset
+		frame.loc += uint64(delta) * caf
 		logger.Debug(fmt.Sprintf("DW_CFA_advance_loc, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
 	case DW_CFA_advance_loc1:
 		delta, err := buf.ReadByte()
 		if err != nil {
 			return err
 		}
-		frame.loc += uint64(delta) * frame.cie.code_alignment_factor
+		frame.loc += uint64(delta) * caf
 		logger.Debug(fmt.Sprintf("DW_CFA_advance_loc1, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
 	case DW_CFA_advance_loc2:
 		var delta uint16
-		binary.Read(buf, binary.LittleEndian, &delta)
-		frame.loc += uint64(delta) * frame.cie.code_alignment_factor
+		if err = binary.Read(buf, binary.LittleEndian, &delta); err != nil {
+			return err
+		}
+		frame.loc += uint64(delta) * caf
 		logger.Debug(fmt.Sprintf("DW_CFA_advance_loc2, delta %d, frame.loc=%d\n", uint64(delta), frame.loc))
+	case DW_CFA_advance_loc4:
+		var delta uint32
+		if err = binary.Read(buf, binary.LittleEndian, &delta); err != nil {
+			return err
+		}
+		frame.loc += uint64(delta) * caf
+
+	case DW_CFA_def_cfa:
+		frame.cfa.reg = uleb()
+		frame.cfa.offset = int64(uleb())
+		frame.cfa.rule = RuleCFA
+		logger.Debug(fmt.Sprintf("DW_CFA_def_cfa, reg %d, offset %d\n", frame.cfa.reg, frame.cfa.offset))
+	case DW_CFA_def_cfa_sf:
+		frame.cfa.reg = uleb()
+		frame.cfa.offset = sleb() * daf
+		frame.cfa.rule = RuleCFA
+	case DW_CFA_def_cfa_register:
+		frame.cfa.reg = uleb()
+		frame.cfa.rule = RuleCFA
+		logger.Debug(fmt.Sprintf("DW_CFA_def_cfa_register, cfa.reg %d, cfa.offset %d\n", frame.cfa.reg, frame.cfa.offset))
+	case DW_CFA_def_cfa_offset:
+		frame.cfa.offset = int64(uleb())
+	case DW_CFA_def_cfa_offset_sf:
+		offset := sleb()
+		frame.cfa.offset = offset * daf
+		logger.Debug(fmt.Sprintf("DW_CFA_def_cfa_offset_sf, offset *= frame.data_aligment_factor, %d = %d * %d\n",
+			frame.cfa.offset, offset, daf))
+	case DW_CFA_def_cfa_expression:
+		frame.cfa = &DWRule{rule: RuleExpression, expression: block()}
+
+	case DW_CFA_offset:
+		if op, err = buf.ReadByte(); err != nil {
+			return err
+		}
+		reg := uint64(op & low_6_offset)
+		frame.regsRule[reg] = DWRule{offset: int64(uleb()) * daf, rule: RuleOffset}
+	case DW_CFA_offset_extended:
+		reg := uleb()
+		frame.regsRule[reg] = DWRule{offset: int64(uleb()) * daf, rule: RuleOffset}
+		logger.Debug(fmt.Sprintf("DW_CFA_offset_extended, reg %d, dwrule.offset %d\n", reg, frame.regsRule[reg].offset))
+	case DW_CFA_offset_extended_sf:
+		reg := uleb()
+		frame.regsRule[reg] = DWRule{offset: sleb() * daf, rule: RuleOffset}
+	case DW_CFA_GNU_negative_offset_extended:
+		reg := uleb()
+		frame.regsRule[reg] = DWRule{offset: -int64(uleb()) * daf, rule: RuleOffset}
+	case DW_CFA_val_offset:
+		reg := uleb()
+		frame.regsRule[reg] = DWRule{offset: int64(uleb()) * daf, rule: RuleValOffset}
+	case DW_CFA_val_offset_sf:
+		reg := uleb()
+		frame.regsRule[reg] = DWRule{offset: sleb() * daf, rule: RuleValOffset}
+	case DW_CFA_undefined:
+		frame.regsRule[uleb()] = DWRule{rule: RuleUndefined}
+	case DW_CFA_same_value:
+		frame.regsRule[uleb()] = DWRule{rule: RuleSameVal}
+	case DW_CFA_register:
+		reg := uleb()
+		frame.regsRule[reg] = DWRule{reg: uleb(), rule: RuleRegister}
+	case DW_CFA_expression:
+		reg := uleb()
+		frame.regsRule[reg] = DWRule{rule: RuleExpression, expression: block()}
+	case DW_CFA_val_expression:
+		reg := uleb()
+		frame.regsRule[reg] = DWRule{rule: RuleValExpression, expression: block()}
+
 	case DW_CFA_restore:
-		if byte, err = buf.ReadByte(); err != nil {
+		if op, err = buf.ReadByte(); err != nil {
 			return err
 		}
-		reg := uint64(byte & low_6_offset)
-		frame.regsRule[reg] = DWRule{rule: RuleUndefined}
-	case DW_CFA_nop:
-		return nil
+		frame.restoreRule(uint64(op & low_6_offset))
+	case DW_CFA_restore_extended:
+		frame.restoreRule(uleb())
+	case DW_CFA_remember_state:
+		frame.states = append(frame.states, frameState{cfa: *frame.cfa, regsRule: copyRules(frame.regsRule)})
+	case DW_CFA_restore_state:
+		if len(frame.states) == 0 {
+			return fmt.Errorf("DW_CFA_restore_state without DW_CFA_remember_state")
+		}
+		state := frame.states[len(frame.states)-1]
+		frame.states = frame.states[:len(frame.states)-1]
+		cfa := state.cfa
+		frame.cfa, frame.regsRule = &cfa, state.regsRule
+	case DW_CFA_GNU_args_size:
+		// the size of arguments pushed on stack, it doesn't change the rules
+		uleb()
 	default:
-		logger.Error("execInstructions unknown byte", zap.Uint8("DW_CFA", byte))
-		return fmt.Errorf("execInstructions unknown byte %v", byte)
+		logger.Error("execInstructions unknown byte", zap.Uint8("DW_CFA", op))
+		return fmt.Errorf("execInstructions unknown byte %v", op)
 	}
 	return nil
 }
 
+// restoreRule changes the rule of reg to the initial rule of CIE
+func (frame *Frame) restoreRule(reg uint64) {
+	if rule, ok := frame.initialRules[reg]; ok {
+		frame.regsRule[reg] = rule
+		return
+	}
+	delete(frame.regsRule, reg)
+}
+
+// frameAt executes the CIE and FDE instructions until pc
+func (fde *FrameDescriptionEntry) frameAt(pc uint64) (*Frame, error) {
+	cie := fde.CIE
+	if cie == nil {
+		return nil, fmt.Errorf("fde.CIE should not be nil")
+	}
+
+	frame := &Frame{cie: cie, fde: fde, cfa: &DWRule{}, regsRule: make(map[uint64]DWRule)}
+	logger.Debug("========================= cie start\n")
+	if err := execCIEInstructions(frame, bytes.NewBuffer(cie.initial_instructions)); err != nil {
+		return nil, err
+	}
+	frame.loc = fde.begin
+	frame.address = pc
+	logger.Debug("========================= cie end\n")
+
+	logger.Debug("========================= fde.instructions start \n")
+	if err := execFDEInstructions(frame, bytes.NewBuffer(fde.instructions)); err != nil {
+		return nil, err
+	}
+	logger.Debug("========================= fde.instructions end \n")
+	return frame, nil
+}
+
 func execCIEInstructions(frame *Frame, buf *bytes.Buffer) error {
 	for buf.Len() > 0 {
 		if err := execSingleInstruction(frame, buf); err != nil {
 			return err
 		}
 	}
+	frame.initialRules = copyRules(frame.regsRule)
 	return nil
 }
-
 func execFDEInstructions(frame *Frame, buf *bytes.Buffer) error {
 	for frame.address >= frame.loc && buf.Len() > 0 {
 		if err := execSingleInstruction(frame, buf); err != nil {
@@ -95,7 +95,7 @@ func listDisassembleByPtracePc(bi *BI, bp *BP, pid int) error {
 		pcBpMap  map[uint64]bool
 	)
 
-	if pc, err = getPtracePc(); err != nil {
+	if pc, err = target.selectedPc(); err != nil {
 		return err
 	}
 	if f, err = bi.findFunctionIncludePc(pc); err != nil {
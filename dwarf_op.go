@@ -1,5 +1,13 @@
 package main
 
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
 // This table is produced by go compiler and linker. copy from https://golang.org/pkg/cmd/internal/dwarf/
 const (
 	DW_OP_addr                = 0x03 // 1 constant address (size target specific)
@@ -67,3 +75,437 @@ const (
 	DW_OP_lo_user             = 0xe0
 	DW_OP_hi_user             = 0xff
 )
+
+// DW_OP_GNU_push_tls_address is emitted by gcc instead of DW_OP_form_tls_address
+const DW_OP_GNU_push_tls_address = 0xe0
+
+// the DWARF register numbers of amd64, see System V Application Binary Interface AMD64 Architecture 3.6.2
+const (
+	dwarfRegRbp   = 6
+	dwarfRegRsp   = 7
+	dwarfRegRip   = 16
+	dwarfRegXmm0  = 17
+	dwarfRegXmm15 = 32
+)
+
+// dwarfRegisters is the registers indexed by DWARF register number, it's used to evaluate location expression
+type dwarfRegisters struct {
+	// gp are rax, rdx, rcx, rbx, rsi, rdi, rbp, rsp, r8 ... r15 and rip in DWARF order
+	gp [dwarfRegRip + 1]uint64
+	// xmm are xmm0 ... xmm15, it's nil when they are unavailable, like the parked goroutine
+	xmm [][]byte
+	// unavailable are the registers which can't be recovered in the caller frame
+	unavailable [dwarfRegRip + 1]bool
+	// cfa is the canonical frame address of current frame, it's used by DW_OP_call_frame_cfa
+	cfa uint64
+	// frameBase is the value of DW_AT_frame_base of current function, it's used by DW_OP_fbreg
+	frameBase uint64
+	// staticBase is the load bias of position-independent executable, it's added to DW_OP_addr
+	staticBase uint64
+	// fsBase is the thread pointer, it's 0 when the goroutine isn't running on thread.
+	// tlsSize is the aligned size of TLS segment of executable, which is just below the thread pointer
+	fsBase  uint64
+	tlsSize uint64
+}
+
+// uint return the value of general purpose register
+func (r *dwarfRegisters) uint(regnum uint64) (uint64, error) {
+	if regnum > dwarfRegRip {
+		return 0, fmt.Errorf("unsupported register %d in address", regnum)
+	}
+	if r.unavailable[regnum] {
+		return 0, fmt.Errorf("register %d is unavailable", regnum)
+	}
+	return r.gp[regnum], nil
+}
+
+// bytes return the content of register, it's 8 bytes of general purpose register, 16 bytes of xmm
+func (r *dwarfRegisters) bytes(regnum uint64) ([]byte, error) {
+	if regnum <= dwarfRegRip {
+		value, err := r.uint(regnum)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, value)
+		return buf, nil
+	}
+	if regnum >= dwarfRegXmm0 && regnum <= dwarfRegXmm15 {
+		if r.xmm == nil {
+			return nil, fmt.Errorf("register xmm%d is unavailable", regnum-dwarfRegXmm0)
+		}
+		return r.xmm[regnum-dwarfRegXmm0], nil
+	}
+	return nil, fmt.Errorf("unsupported register %d", regnum)
+}
+
+type locationKind int
+
+const (
+	// locMemory is the variable at addr
+	locMemory locationKind = iota
+	// locRegister is the variable in the register regnum
+	locRegister
+	// locPieces is the variable split into pieces by DW_OP_piece
+	locPieces
+	// locEmpty is the piece which is optimized out
+	locEmpty
+)
+
+// dwarfLocation is the result of location expression
+type dwarfLocation struct {
+	kind   locationKind
+	addr   uint64
+	regnum uint64
+	pieces []*dwarfLocation
+	// size is the bytes of piece, it's zero unless the location is one of pieces
+	size int
+}
+
+// evalLocation is the stack machine of DWARF location expression, see DWARF 4 2.5 and 2.6.
+// The memory is read by readMemory, which is used by DW_OP_deref.
+func evalLocation(expr []byte, regs *dwarfRegisters, readMemory func(addr uint64, size int) ([]byte, error)) (*dwarfLocation, error) {
+	var (
+		stack  []uint64
+		pieces []*dwarfLocation
+		// regnum is set by DW_OP_regN, the value is in the register rather than the address on stack
+		regnum = int64(-1)
+		buf    = bytes.NewBuffer(expr)
+	)
+	pop := func() (uint64, error) {
+		if len(stack) == 0 {
+			return 0, errors.New("dwarf expression stack is empty")
+		}
+		v := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return v, nil
+	}
+	pop2 := func() (uint64, uint64, error) {
+		b, err := pop()
+		if err != nil {
+			return 0, 0, err
+		}
+		a, err := pop()
+		return a, b, err
+	}
+	push := func(v uint64) { stack = append(stack, v) }
+	readN := func(n int) ([]byte, error) {
+		b := buf.Next(n)
+		if len(b) != n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return b, nil
+	}
+	deref := func(size int) error {
+		addr, err := pop()
+		if err != nil {
+			return err
+		}
+		data, err := readMemory(addr, size)
+		if err != nil {
+			return err
+		}
+		v := make([]byte, 8)
+		copy(v, data)
+		push(binary.LittleEndian.Uint64(v))
+		return nil
+	}
+	// the location before DW_OP_piece is the register, the address on stack, or nothing when it's optimized out
+	piece := func(size int) {
+		loc := &dwarfLocation{kind: locEmpty, size: size}
+		if regnum >= 0 {
+			loc.kind, loc.regnum = locRegister, uint64(regnum)
+		} else if len(stack) > 0 {
+			loc.kind, loc.addr = locMemory, stack[len(stack)-1]
+		}
+		pieces = append(pieces, loc)
+		regnum, stack = -1, stack[:0]
+	}
+
+	for buf.Len() > 0 {
+		op, _ := buf.ReadByte()
+		var err error
+		switch {
+		case op >= DW_OP_lit0 && op <= DW_OP_lit31:
+			push(uint64(op - DW_OP_lit0))
+			continue
+		case op >= DW_OP_reg0 && op <= DW_OP_reg31:
+			regnum = int64(op - DW_OP_reg0)
+			continue
+		case op >= DW_OP_breg0 && op <= DW_OP_breg31:
+			offset, _, err := DecodeSLEB128(buf)
+			if err != nil {
+				return nil, err
+			}
+			v, err := regs.uint(uint64(op - DW_OP_breg0))
+			if err != nil {
+				return nil, err
+			}
+			push(uint64(int64(v) + offset))
+			continue
+		}
+
+		switch op {
+		case DW_OP_addr:
+			var b []byte
+			if b, err = readN(8); err == nil {
+				push(binary.LittleEndian.Uint64(b) + regs.staticBase)
+			}
+		case DW_OP_const1u, DW_OP_const1s, DW_OP_const2u, DW_OP_const2s, DW_OP_const4u, DW_OP_const4s, DW_OP_const8u, DW_OP_const8s:
+			size := map[byte]int{DW_OP_const1u: 1, DW_OP_const1s: 1, DW_OP_const2u: 2, DW_OP_const2s: 2,
+				DW_OP_const4u: 4, DW_OP_const4s: 4, DW_OP_const8u: 8, DW_OP_const8s: 8}[op]
+			var b []byte
+			if b, err = readN(size); err != nil {
+				break
+			}
+			v := make([]byte, 8)
+			copy(v, b)
+			n := binary.LittleEndian.Uint64(v)
+			// sign extend the signed constant
+			if signed := (op-DW_OP_const1u)%2 == 1; signed && size < 8 && b[size-1]&0x80 != 0 {
+				n |= ^uint64(0) << (8 * uint(size))
+			}
+			push(n)
+		case DW_OP_constu:
+			var n uint64
+			if n, _, err = DecodeULEB128(buf); err == nil {
+				push(n)
+			}
+		case DW_OP_consts:
+			var n int64
+			if n, _, err = DecodeSLEB128(buf); err == nil {
+				push(uint64(n))
+			}
+		case DW_OP_dup:
+			if len(stack) < 1 {
+				return nil, errors.New("dwarf expression stack is empty")
+			}
+			push(stack[len(stack)-1])
+		case DW_OP_drop:
+			_, err = pop()
+		case DW_OP_over:
+			if len(stack) < 2 {
+				return nil, errors.New("dwarf expression stack underflow")
+			}
+			push(stack[len(stack)-2])
+		case DW_OP_pick:
+			var b []byte
+			if b, err = readN(1); err != nil {
+				break
+			}
+			if int(b[0]) >= len(stack) {
+				return nil, errors.New("dwarf expression stack underflow")
+			}
+			push(stack[len(stack)-1-int(b[0])])
+		case DW_OP_swap:
+			var a, b uint64
+			if a, b, err = pop2(); err == nil {
+				push(b)
+				push(a)
+			}
+		case DW_OP_rot:
+			if len(stack) < 3 {
+				return nil, errors.New("dwarf expression stack underflow")
+			}
+			n := len(stack)
+			stack[n-1], stack[n-2], stack[n-3] = stack[n-2], stack[n-3], stack[n-1]
+		case DW_OP_deref, DW_OP_deref_size, DW_OP_xderef, DW_OP_xderef_size:
+			size := 8
+			if op == DW_OP_deref_size || op == DW_OP_xderef_size {
+				var b []byte
+				if b, err = readN(1); err != nil {
+					break
+				}
+				size = int(b[0])
+			}
+			// the address space under the address is ignored, there is only one on amd64
+			if op == DW_OP_xderef || op == DW_OP_xderef_size {
+				var addr uint64
+				if _, addr, err = pop2(); err != nil {
+					break
+				}
+				push(addr)
+			}
+			err = deref(size)
+		case DW_OP_abs, DW_OP_neg, DW_OP_not:
+			var a uint64
+			if a, err = pop(); err != nil {
+				break
+			}
+			switch op {
+			case DW_OP_abs:
+				if int64(a) < 0 {
+					a = uint64(-int64(a))
+				}
+			case DW_OP_neg:
+				a = uint64(-int64(a))
+			case DW_OP_not:
+				a = ^a
+			}
+			push(a)
+		case DW_OP_plus_uconst:
+			var n, a uint64
+			if n, _, err = DecodeULEB128(buf); err != nil {
+				break
+			}
+			if a, err = pop(); err == nil {
+				push(a + n)
+			}
+		case DW_OP_and, DW_OP_div, DW_OP_minus, DW_OP_mod, DW_OP_mul, DW_OP_or, DW_OP_plus,
+			DW_OP_shl, DW_OP_shr, DW_OP_shra, DW_OP_xor,
+			DW_OP_eq, DW_OP_ge, DW_OP_gt, DW_OP_le, DW_OP_lt, DW_OP_ne:
+			var a, b uint64
+			if a, b, err = pop2(); err != nil {
+				break
+			}
+			var v uint64
+			if v, err = binaryOp(op, a, b); err == nil {
+				push(v)
+			}
+		case DW_OP_skip, DW_OP_bra:
+			var b []byte
+			if b, err = readN(2); err != nil {
+				break
+			}
+			offset := int(int16(binary.LittleEndian.Uint16(b)))
+			if op == DW_OP_bra {
+				var cond uint64
+				if cond, err = pop(); err != nil || cond == 0 {
+					break
+				}
+			}
+			pos := len(expr) - buf.Len() + offset
+			if pos < 0 || pos > len(expr) {
+				return nil, fmt.Errorf("dwarf expression branches out of range %d", pos)
+			}
+			buf = bytes.NewBuffer(expr[pos:])
+		case DW_OP_regx:
+			var n uint64
+			if n, _, err = DecodeULEB128(buf); err == nil {
+				regnum = int64(n)
+			}
+		case DW_OP_fbreg:
+			var offset int64
+			if offset, _, err = DecodeSLEB128(buf); err == nil {
+				push(uint64(int64(regs.frameBase) + offset))
+			}
+		case DW_OP_bregx:
+			var (
+				n      uint64
+				offset int64
+				v      uint64
+			)
+			if n, _, err = DecodeULEB128(buf); err != nil {
+				break
+			}
+			if offset, _, err = DecodeSLEB128(buf); err != nil {
+				break
+			}
+			if v, err = regs.uint(n); err == nil {
+				push(uint64(int64(v) + offset))
+			}
+		case DW_OP_piece:
+			var size uint64
+			if size, _, err = DecodeULEB128(buf); err == nil {
+				piece(int(size))
+			}
+		case DW_OP_bit_piece:
+			var size, offset uint64
+			if size, _, err = DecodeULEB128(buf); err != nil {
+				break
+			}
+			if offset, _, err = DecodeULEB128(buf); err != nil {
+				break
+			}
+			if size%8 != 0 || offset != 0 {
+				return nil, fmt.Errorf("unsupported DW_OP_bit_piece of %d bits at offset %d", size, offset)
+			}
+			piece(int(size / 8))
+		case DW_OP_nop:
+		case DW_OP_call_frame_cfa:
+			push(regs.cfa)
+		case DW_OP_form_tls_address, DW_OP_GNU_push_tls_address:
+			// the offset is in the TLS block of executable, see ELF Handling For Thread-Local Storage 4.4.6
+			var offset uint64
+			if offset, err = pop(); err != nil {
+				break
+			}
+			if regs.fsBase == 0 {
+				return nil, errors.New("the thread pointer is unavailable")
+			}
+			push(regs.fsBase - regs.tlsSize + offset)
+		case DW_OP_push_object_address, DW_OP_call2, DW_OP_call4, DW_OP_call_ref:
+			// the object address and the DIE procedures are used by the languages like Fortran and Ada,
+			// neither go compiler nor gcc emits them for the location of variable
+			return nil, fmt.Errorf("unsupported dwarf operation 0x%x", op)
+		default:
+			return nil, fmt.Errorf("unknown dwarf operation 0x%x", op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(pieces) > 0 {
+		return &dwarfLocation{kind: locPieces, pieces: pieces}, nil
+	}
+	if regnum >= 0 {
+		return &dwarfLocation{kind: locRegister, regnum: uint64(regnum)}, nil
+	}
+	addr, err := pop()
+	if err != nil {
+		return nil, err
+	}
+	return &dwarfLocation{kind: locMemory, addr: addr}, nil
+}
+
+// binaryOp calculates `a op b` of the values on stack, the comparison pushes 1 if it's true
+func binaryOp(op byte, a, b uint64) (uint64, error) {
+	bool2uint := func(v bool) uint64 {
+		if v {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case DW_OP_and:
+		return a & b, nil
+	case DW_OP_or:
+		return a | b, nil
+	case DW_OP_xor:
+		return a ^ b, nil
+	case DW_OP_plus:
+		return a + b, nil
+	case DW_OP_minus:
+		return a - b, nil
+	case DW_OP_mul:
+		return a * b, nil
+	case DW_OP_div, DW_OP_mod:
+		if b == 0 {
+			return 0, errors.New("dwarf expression divides by zero")
+		}
+		if op == DW_OP_div {
+			return uint64(int64(a) / int64(b)), nil
+		}
+		return a % b, nil
+	case DW_OP_shl:
+		return a << b, nil
+	case DW_OP_shr:
+		return a >> b, nil
+	case DW_OP_shra:
+		return uint64(int64(a) >> b), nil
+	case DW_OP_eq:
+		return bool2uint(int64(a) == int64(b)), nil
+	case DW_OP_ge:
+		return bool2uint(int64(a) >= int64(b)), nil
+	case DW_OP_gt:
+		return bool2uint(int64(a) > int64(b)), nil
+	case DW_OP_le:
+		return bool2uint(int64(a) <= int64(b)), nil
+	case DW_OP_lt:
+		return bool2uint(int64(a) < int64(b)), nil
+	case DW_OP_ne:
+		return bool2uint(int64(a) != int64(b)), nil
+	}
+	return 0, fmt.Errorf("unknown dwarf operation 0x%x", op)
+}
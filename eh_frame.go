@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// the pointer encodings of .eh_frame,
+// https://refspecs.linuxfoundation.org/LSB_5.0.0/LSB-Core-generic/LSB-Core-generic/ehframechpt.html
+const (
+	DW_EH_PE_absptr  = 0x00
+	DW_EH_PE_uleb128 = 0x01
+	DW_EH_PE_udata2  = 0x02
+	DW_EH_PE_udata4  = 0x03
+	DW_EH_PE_udata8  = 0x04
+	DW_EH_PE_sleb128 = 0x09
+	DW_EH_PE_sdata2  = 0x0a
+	DW_EH_PE_sdata4  = 0x0b
+	DW_EH_PE_sdata8  = 0x0c
+
+	DW_EH_PE_pcrel   = 0x10
+	DW_EH_PE_textrel = 0x20
+	DW_EH_PE_datarel = 0x30
+	DW_EH_PE_funcrel = 0x40
+	DW_EH_PE_aligned = 0x50
+
+	DW_EH_PE_indirect = 0x80
+	DW_EH_PE_omit     = 0xff
+)
+
+// readEncodedPointer reads the pointer by the encoding, pc is the address of the pointer for DW_EH_PE_pcrel,
+// datarel is the base address for DW_EH_PE_datarel
+func readEncodedPointer(buf *bytes.Buffer, enc byte, pc, datarel uint64) (uint64, error) {
+	if enc == DW_EH_PE_omit {
+		return 0, nil
+	}
+	var (
+		value uint64
+		err   error
+	)
+	read := func(size int) []byte {
+		if buf.Len() < size {
+			err = fmt.Errorf("the pointer needs %d bytes, but there are %d bytes", size, buf.Len())
+			return make([]byte, 8)
+		}
+		return buf.Next(size)
+	}
+	switch enc & 0x0f {
+	case DW_EH_PE_absptr, DW_EH_PE_udata8, DW_EH_PE_sdata8:
+		value = binary.LittleEndian.Uint64(read(8))
+	case DW_EH_PE_uleb128:
+		value, _, err = DecodeULEB128(buf)
+	case DW_EH_PE_udata2:
+		value = uint64(binary.LittleEndian.Uint16(read(2)))
+	case DW_EH_PE_udata4:
+		value = uint64(binary.LittleEndian.Uint32(read(4)))
+	case DW_EH_PE_sleb128:
+		var v int64
+		v, _, err = DecodeSLEB128(buf)
+		value = uint64(v)
+	case DW_EH_PE_sdata2:
+		value = uint64(int16(binary.LittleEndian.Uint16(read(2))))
+	case DW_EH_PE_sdata4:
+		value = uint64(int32(binary.LittleEndian.Uint32(read(4))))
+	default:
+		return 0, fmt.Errorf("unsupported pointer format 0x%x", enc&0x0f)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch enc & 0x70 {
+	case DW_EH_PE_absptr:
+	case DW_EH_PE_pcrel:
+		value += pc
+	case DW_EH_PE_datarel:
+		value += datarel
+	default:
+		return 0, fmt.Errorf("unsupported pointer application 0x%x", enc&0x70)
+	}
+	if enc&DW_EH_PE_indirect != 0 {
+		return 0, errors.New("unsupported indirect pointer")
+	}
+	return value, nil
+}
+
+// parseAugmentation parses the augmentation data of cie, the data is described by the augmentation string.
+// The personality and LSDA are only used by the exception handling, they are skipped.
+func parseAugmentation(cie *CommonInformationEntry, buf *bytes.Buffer) error {
+	cie.fdeEncoding = DW_EH_PE_absptr
+	if cie.augmentation == "" {
+		return nil
+	}
+	if cie.augmentation[0] != 'z' {
+		// the size of augmentation data is unknown without 'z', e.g. "eh" of old gcc
+		return fmt.Errorf("unsupported augmentation %q", cie.augmentation)
+	}
+	cie.hasAugmentationData = true
+	size, _, err := DecodeULEB128(buf)
+	if err != nil {
+		return err
+	}
+	if uint64(buf.Len()) < size {
+		return fmt.Errorf("the augmentation data needs %d bytes, but there are %d bytes", size, buf.Len())
+	}
+	data := bytes.NewBuffer(buf.Next(int(size)))
+	for _, c := range cie.augmentation[1:] {
+		switch c {
+		case 'R':
+			if cie.fdeEncoding, err = data.ReadByte(); err != nil {
+				return err
+			}
+		case 'P':
+			enc, err := data.ReadByte()
+			if err != nil {
+				return err
+			}
+			if _, err = readEncodedPointer(data, enc&^DW_EH_PE_indirect, 0, 0); err != nil {
+				return err
+			}
+		case 'L':
+			if _, err = data.ReadByte(); err != nil {
+				return err
+			}
+		case 'S', 'B':
+			// 'S' is the signal frame, 'B' is the pointer authentication of aarch64
+		default:
+			// the rest of augmentation data is skipped by the size
+			return nil
+		}
+	}
+	return nil
+}
+
+// skipAugmentationData skips the augmentation data at the front of fde instructions
+func skipAugmentationData(fde *FrameDescriptionEntry) error {
+	buf := bytes.NewBuffer(fde.instructions)
+	size, _, err := DecodeULEB128(buf)
+	if err != nil {
+		return err
+	}
+	if uint64(buf.Len()) < size {
+		return fmt.Errorf("the augmentation data needs %d bytes, but there are %d bytes", size, buf.Len())
+	}
+	buf.Next(int(size))
+	fde.instructions = buf.Bytes()
+	return nil
+}
+
+// ehFrame is the .eh_frame section, it's generated by the external linker and C compiler.
+// The FDEs are searched by the sorted table, which is the binary search table of .eh_frame_hdr,
+// or built by parsing all FDEs if .eh_frame_hdr doesn't exist.
+type ehFrame struct {
+	data []byte
+	addr uint64
+	// staticBase is the load bias of position-independent executable, the pc relative addresses are moved with addr
+	staticBase uint64
+	// cies are cached by the offset in .eh_frame
+	cies  map[uint64]*CommonInformationEntry
+	table []ehFrameTableEntry
+}
+
+type ehFrameTableEntry struct {
+	pc uint64
+	// off is the offset of FDE in .eh_frame
+	off uint64
+}
+
+// newEhFrame parses .eh_frame at addr, hdr is the content of .eh_frame_hdr at hdrAddr, it may be nil
+func newEhFrame(data []byte, addr uint64, hdr []byte, hdrAddr uint64) (*ehFrame, error) {
+	eh := &ehFrame{data: data, addr: addr, cies: make(map[uint64]*CommonInformationEntry)}
+	if hdr != nil {
+		table, err := eh.parseHdr(hdr, hdrAddr)
+		if err != nil {
+			return nil, err
+		}
+		if table != nil {
+			eh.table = table
+			return eh, nil
+		}
+	}
+
+	// there is no search table, all FDEs are parsed to build it
+	for off := uint64(0); off < uint64(len(data)); {
+		body, _, next, err := eh.entry(off)
+		if err != nil {
+			return nil, err
+		}
+		if body == nil {
+			break
+		}
+		if binary.LittleEndian.Uint32(body) != 0 {
+			fde, err := eh.parseFDE(off)
+			if err != nil {
+				return nil, err
+			}
+			eh.table = append(eh.table, ehFrameTableEntry{pc: fde.begin, off: off})
+		}
+		off = next
+	}
+	sort.Slice(eh.table, func(i, j int) bool { return eh.table[i].pc < eh.table[j].pc })
+	return eh, nil
+}
+
+// parseHdr parses the binary search table of .eh_frame_hdr, it return nil if the table is omitted
+func (eh *ehFrame) parseHdr(hdr []byte, hdrAddr uint64) ([]ehFrameTableEntry, error) {
+	if len(hdr) < 4 {
+		return nil, errors.New("the .eh_frame_hdr is too short")
+	}
+	if hdr[0] != 1 {
+		return nil, fmt.Errorf("unsupported .eh_frame_hdr version %d", hdr[0])
+	}
+	ehFramePtrEnc, countEnc, tableEnc := hdr[1], hdr[2], hdr[3]
+	buf := bytes.NewBuffer(hdr[4:])
+	pos := func() uint64 { return hdrAddr + uint64(len(hdr)-buf.Len()) }
+
+	if _, err := readEncodedPointer(buf, ehFramePtrEnc, pos(), hdrAddr); err != nil {
+		return nil, err
+	}
+	if countEnc == DW_EH_PE_omit || tableEnc == DW_EH_PE_omit {
+		return nil, nil
+	}
+	count, err := readEncodedPointer(buf, countEnc, pos(), hdrAddr)
+	if err != nil {
+		return nil, err
+	}
+	table := make([]ehFrameTableEntry, 0, count)
+	for i := uint64(0); i < count; i++ {
+		pc, err := readEncodedPointer(buf, tableEnc, pos(), hdrAddr)
+		if err != nil {
+			return nil, err
+		}
+		fdeAddr, err := readEncodedPointer(buf, tableEnc, pos(), hdrAddr)
+		if err != nil {
+			return nil, err
+		}
+		if fdeAddr < eh.addr || fdeAddr >= eh.addr+uint64(len(eh.data)) {
+			return nil, fmt.Errorf("the fde 0x%x is out of .eh_frame", fdeAddr)
+		}
+		table = append(table, ehFrameTableEntry{pc: pc, off: fdeAddr - eh.addr})
+	}
+	return table, nil
+}
+
+// entry return the body of entry at off, which starts with the CIE id or CIE pointer,
+// the offset of body and the offset of next entry. The body is nil for the terminator.
+func (eh *ehFrame) entry(off uint64) ([]byte, uint64, uint64, error) {
+	if off+4 > uint64(len(eh.data)) {
+		return nil, 0, 0, fmt.Errorf("the entry at 0x%x is out of .eh_frame", off)
+	}
+	length := uint64(binary.LittleEndian.Uint32(eh.data[off:]))
+	start := off + 4
+	if length == 0xffffffff {
+		if start+8 > uint64(len(eh.data)) {
+			return nil, 0, 0, fmt.Errorf("the entry at 0x%x is out of .eh_frame", off)
+		}
+		length = binary.LittleEndian.Uint64(eh.data[start:])
+		start += 8
+	}
+	if length == 0 {
+		return nil, start, start, nil
+	}
+	end := start + length
+	if length < 4 || end > uint64(len(eh.data)) {
+		return nil, 0, 0, fmt.Errorf("the entry at 0x%x is out of .eh_frame", off)
+	}
+	return eh.data[start:end], start, end, nil
+}
+
+// cie return the CIE at off
+func (eh *ehFrame) cie(off uint64) (*CommonInformationEntry, error) {
+	if cie, ok := eh.cies[off]; ok {
+		return cie, nil
+	}
+	body, _, _, err := eh.entry(off)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil || binary.LittleEndian.Uint32(body) != 0 {
+		return nil, fmt.Errorf("the entry at 0x%x isn't a cie", off)
+	}
+	cie, err := parseCommonInformationEntryByte(uint32(len(body)), body[4:])
+	if err != nil {
+		return nil, err
+	}
+	cie.cie_id = 0
+	eh.cies[off] = cie
+	return cie, nil
+}
+
+// parseFDE parses the FDE at off, the CIE pointer is the distance from itself to the CIE
+func (eh *ehFrame) parseFDE(off uint64) (*FrameDescriptionEntry, error) {
+	body, start, _, err := eh.entry(off)
+	if err != nil {
+		return nil, err
+	}
+	if body == nil || binary.LittleEndian.Uint32(body) == 0 || uint64(binary.LittleEndian.Uint32(body)) > start {
+		return nil, fmt.Errorf("the entry at 0x%x isn't a fde", off)
+	}
+	cie, err := eh.cie(start - uint64(binary.LittleEndian.Uint32(body)))
+	if err != nil {
+		return nil, err
+	}
+
+	fde := &FrameDescriptionEntry{length: uint32(len(body)), CIE: cie}
+	buf := bytes.NewBuffer(body[4:])
+	pos := eh.addr + start + 4
+	if fde.begin, err = readEncodedPointer(buf, cie.fdeEncoding, pos, 0); err != nil {
+		return nil, err
+	}
+	// the address range only uses the format of encoding
+	if fde.size, err = readEncodedPointer(buf, cie.fdeEncoding&0x0f, 0, 0); err != nil {
+		return nil, err
+	}
+	fde.instructions = buf.Bytes()
+	if cie.hasAugmentationData {
+		if err = skipAugmentationData(fde); err != nil {
+			return nil, err
+		}
+	}
+	fde.instructionsAddr = eh.addr + start + uint64(len(body)-len(fde.instructions))
+	fde.staticBase = eh.staticBase
+	return fde, nil
+}
+
+// findFDE return the FDE covers pc, or nil if there isn't
+func (eh *ehFrame) findFDE(pc uint64) (*FrameDescriptionEntry, error) {
+	i := sort.Search(len(eh.table), func(i int) bool { return eh.table[i].pc > pc })
+	if i == 0 {
+		return nil, nil
+	}
+	fde, err := eh.parseFDE(eh.table[i-1].off)
+	if err != nil {
+		return nil, err
+	}
+	if fde.begin <= pc && pc < fde.begin+fde.size {
+		return fde, nil
+	}
+	return nil, nil
+}
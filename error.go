@@ -3,11 +3,13 @@ package main
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var NotFoundSourceLineErr = errors.New("cant't find this source line")
 var HasExistedBreakPointErr = errors.New("this breakpoint has existed")
 var NoProcessRuning = errors.New("there is no process running")
+var OptimizedOutErr = errors.New("optimized out")
 
 type NotFoundFuncErr struct {
 	pc uint64
@@ -18,7 +20,14 @@ func (e *NotFoundFuncErr) Error() string {
 }
 
 func printExecutableProgramHelper() {
-	fmt.Fprintf(stderr, "%s\n", "Usage:\n\tJust like `godbg debug ./main.go`.\n\tThe `main.go` is the file which you want debug.")
+	fmt.Fprintf(stderr, "%s\n", "Usage:\n\tJust like `godbg debug ./main.go`.\n\tThe `main.go` is the file which you want debug.\n"+
+		"\tThe directory or the package is supported too, like `godbg debug ./cmd/server`.\n"+
+		"\tOr `godbg test ./pkg -- -test.run TestX` to debug the test binary.\n"+
+		"\tOr `godbg exec ./main -- args` to debug the executable file which has been built.\n"+
+		"\t`debug` and `exec` also support `--env KEY=VAL`, `--wd <dir>`, `--redirect stdin=<file>`\n"+
+		"\tand the arguments of programe after `--`.\n"+
+		"\t`debug` and `test` pass `--build-flags \"-tags foo -race\"` to `go build`.\n"+
+		"\tOr `godbg attach <pid>` to trace the running process.")
 }
 
 // printCmdHelper print all usages of cmd.
@@ -27,20 +36,51 @@ func printExecutableProgramHelper() {
 func printCmdHelper() {
 	fmt.Fprintf(stderr, "Usage:\n"+
 		"\t q  (quit)                   ----   quit the debugger.\n"+
-		"\t b  (break) <filename:line>  ----   set an breakpoint at specific the line of filename.\n"+
-		"\t bc (bclear) all             ----   clear all breakpoints.\n"+
-		"\t bl [all]                    ----   list all breakpoints if `all`.\n"+
-		"\t bt                          ----   show call stack.\n"+
+		"\t b  (break) <loc>            ----   set an breakpoint, loc is <filename:line>, `:line` or `+n` in current file,\n"+
+		"\t                                    `*0x4a1b20` for address, or function like `main.handler`, `(*Server).ServeHTTP`.\n"+
+		"\t    [hits<op>N] [if <expr>]          it stops only when the hit count matches and expr is true,\n"+
+		"\t                                    like `b main.go:10 hits>=3`, `b main.go:10 if i == 3`, op is ==, !=, >=, <=, >, < or %%.\n"+
+		"\t tbreak <loc> ...            ----   set a temporary breakpoint, it's cleared after the first stop.\n"+
+		"\t rbreak <regex>              ----   set breakpoints at all functions matching regex, like `rbreak ^main\\.`.\n"+
+		"\t cond <n> [<expr>]           ----   change the condition of breakpoint n in `bl`, remove it without expr.\n"+
+		"\t ignore <n> <count>          ----   ignore the next count hits of breakpoint n in `bl`.\n"+
+		"\t bc (bclear) <n>|all         ----   clear the breakpoint n in `bl` or all breakpoints, the others keep their numbers.\n"+
+		"\t enable <n>|all              ----   enable the breakpoint n in `bl` or all breakpoints.\n"+
+		"\t disable <n>|all             ----   disable the breakpoint n in `bl` or all breakpoints, they are kept in `bl`.\n"+
+		"\t bl [all]                    ----   list breakpoints with the hit counts, internal ones if `all`.\n"+
+		"\t                                    the line emitted in several places, like inlined calls, has locations `1.1`, `1.2`.\n"+
+		"\t bt [-full] [-all] [<depth>] ----   show call stack with arguments, `*` is the selected frame.\n"+
+		"\t                                    `-full` prints locals, `-all` prints all goroutines.\n"+
 		"\t c  (continue)               ----   continue the paused programe.\n"+
 		"\t s  (step)                   ----   step one instruction.\n"+
 		"\t n  (next)                   ----   next step for source code.\n"+
 		"\t l  (list) <filename:line>   ----   show the code for specific the line of filename.\n"+
-		"\t r  (restart)                ----   restart the traced programe.\n"+
+		"\t r  (restart) [-- args]      ----   restart the traced programe, change the arguments if `-- args`.\n"+
+		"\t detach                      ----   restore all breakpoints and detach the traced programe.\n"+
 		"\t disass (disassemble)        ----   show the asm at cur breakpoint.\n"+
-		"\t p  (print) <varibale>       ----   print the variable.but just support string type for now.\n"+
+		"\t threads                     ----   list all threads, `*` is the current thread.\n"+
+		"\t thread <tid>                ----   switch the current thread.\n"+
+		"\t goroutines                  ----   list all goroutines, `*` is the current goroutine.\n"+
+		"\t goroutine <id>              ----   switch the current goroutine, bt/list/print use it.\n"+
+		"\t frame <n>                   ----   select the frame of call stack, print/locals/list/disass use it.\n"+
+		"\t up [n] / down [n]           ----   select the caller / callee frame.\n"+
+		"\t p  (print) <expr>           ----   print the go expression, like `p.X`, `s[1:]`, `m[\"k\"]`, `*(*T)(0xc000010000)`, `len(s)+1`.\n"+
+		"\t locals                      ----   print the local variables visible at current line.\n"+
+		"\t args                        ----   print the arguments and the return values of current function.\n"+
+		"\t vars [<regex>]              ----   print the package variables matching regex.\n"+
+		"\t set <expr> = <value>        ----   change the variable, like `set p.X = 3`, `set s = t`, `set ptr = nil`.\n"+
+		"\t set reg <name> <value>      ----   change the register of current thread, like `set reg rax 0x10`.\n"+
+		"\t write <addr> <bytes>        ----   write the hex bytes to memory, like `write 0xc000010000 0102ff`.\n"+
+		"\t call <fn>(<args>)           ----   call the function in current goroutine, like `call add(1, 2)`, `call p.String()`.\n"+
+		"\t config [<name> <n>]         ----   show or change max-depth, max-array-len, max-string-len of print.\n"+
 		"\t h  (help)                   ----   show the usage for cmd.\n")
 }
 
+func printOptimizedWarning(names []string) {
+	fmt.Fprintf(stderr, "warning: %s built with optimizations or inlining, debugging may be inaccurate.\n"+
+		"\tPlease build with `-gcflags all=-N -l`.\n", strings.Join(names, ", "))
+}
+
 func printUnsupportCmd(cmd string) {
 	fmt.Fprintf(stderr, "unsupport cmd `%s`\n", cmd)
 }
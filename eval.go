@@ -0,0 +1,997 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"math"
+	"strings"
+)
+
+// maxEvalStringLength limits the string read by expression, like `s == "abc"`
+const maxEvalStringLength = 1 << 20
+
+// evalScope is the function and frame where the expression is evaluated
+type evalScope struct {
+	bi    *BI
+	pc    uint64
+	line  int
+	fn    *Function
+	frame *stackFrame
+	regs  *dwarfRegisters
+}
+
+// newEvalScope return the scope of the selected frame in the selected goroutine
+func newEvalScope(bi *BI) (*evalScope, error) {
+	frame, err := target.selectedFrame()
+	if err != nil {
+		return nil, err
+	}
+	return newFrameScope(bi, frame)
+}
+
+// newFrameScope return the scope of the frame
+func newFrameScope(bi *BI, frame *stackFrame) (*evalScope, error) {
+	var err error
+	scope := &evalScope{bi: bi, pc: frame.lookupPc(), regs: frame.regs, frame: frame, fn: frame.fn}
+	if _, scope.line, err = bi.pcTofileLine(scope.pc); err != nil {
+		return nil, err
+	}
+	// the frame base of go function is DW_OP_call_frame_cfa
+	regs := scope.regs
+	regs.frameBase, regs.staticBase, regs.tlsSize = regs.cfa, bi.staticBase, bi.tlsSize
+	if len(scope.fn.frameBase) > 0 {
+		loc, err := evalLocation(scope.fn.frameBase, regs, target.readMemory)
+		if err != nil {
+			return nil, err
+		}
+		if loc.kind != locMemory {
+			return nil, fmt.Errorf("unsupported frame base of function %s", scope.fn.name)
+		}
+		regs.frameBase = loc.addr
+	}
+	return scope, nil
+}
+
+// evalString evaluates the go expression
+func (scope *evalScope) evalString(expr string) (*Variable, error) {
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	return scope.eval(node)
+}
+
+// packageName return the package of current function, like `main` of `main.main`
+func (scope *evalScope) packageName() string {
+	name := scope.fn.name
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
+
+// findVariable finds the local variable of current function, then the package variable
+func (scope *evalScope) findVariable(name string) (*Variable, error) {
+	for _, lv := range scope.fn.scopeVariables(scope.pc, scope.line) {
+		if lv.name == name {
+			return scope.newLocalVariable(lv)
+		}
+	}
+	for _, global := range []string{name, scope.packageName() + "." + name} {
+		if _, ok := scope.bi.Globals[global]; ok {
+			addr, typ, err := scope.bi.findGlobalVariable(global)
+			if err != nil {
+				return nil, err
+			}
+			return newVariable(name, addr, typ), nil
+		}
+	}
+	return nil, fmt.Errorf("can't find variable %s", name)
+}
+
+// newLocalVariable return the variable located by its DWARF location
+func (scope *evalScope) newLocalVariable(lv *localVariable) (*Variable, error) {
+	typ, err := scope.bi.entryType(lv.entry)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := scope.bi.locationExpr(lv.entry, scope.fn.cu, scope.pc)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := evalLocation(expr, scope.regs, target.readMemory)
+	if err != nil {
+		return nil, err
+	}
+	v, err := scope.variableAt(lv.name, loc, typ)
+	if err != nil {
+		return nil, err
+	}
+	// the variable escaped to heap is named `&v`, it's the pointer to the value
+	if entryName, _ := lv.entry.Val(dwarf.AttrName).(string); entryName != lv.name {
+		ptr, ok := resolveTypedef(typ).(*dwarf.PtrType)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type %s of variable %s", typeName(typ), entryName)
+		}
+		addr, err := v.uint()
+		if err != nil {
+			return nil, err
+		}
+		v = newVariable(lv.name, addr, ptr.Type)
+	}
+	return v, nil
+}
+
+// variableAt return the variable at the location, the value in registers or pieces is copied to data
+func (scope *evalScope) variableAt(name string, loc *dwarfLocation, typ dwarf.Type) (*Variable, error) {
+	if loc.kind == locMemory {
+		return newVariable(name, loc.addr, typ), nil
+	}
+	pieces := loc.pieces
+	if loc.kind == locRegister {
+		pieces = []*dwarfLocation{{kind: locRegister, regnum: loc.regnum, size: int(typ.Size())}}
+	}
+	data := make([]byte, 0, typ.Size())
+	for _, piece := range pieces {
+		var (
+			buf []byte
+			err error
+		)
+		switch piece.kind {
+		case locMemory:
+			buf, err = target.readMemory(piece.addr, piece.size)
+		case locRegister:
+			if buf, err = scope.regs.bytes(piece.regnum); err == nil && len(buf) > piece.size {
+				buf = buf[:piece.size]
+			}
+		default:
+			err = OptimizedOutErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, buf...)
+	}
+	if int64(len(data)) < typ.Size() {
+		data = append(data, make([]byte, typ.Size()-int64(len(data)))...)
+	}
+	return &Variable{name: name, typ: typ, data: data[:typ.Size()]}, nil
+}
+
+// locals return the local variables visible at pc, or the parameters including return values
+func (scope *evalScope) locals(args bool) []*localVariable {
+	vars := make([]*localVariable, 0)
+	for _, lv := range scope.fn.scopeVariables(scope.pc, scope.line) {
+		if lv.isArg == args {
+			vars = append(vars, lv)
+		}
+	}
+	return vars
+}
+
+// printLocals prints `name = value` of the variables, the error is printed as the value
+func printLocals(scope *evalScope, vars []*localVariable) {
+	for _, lv := range vars {
+		fmt.Fprintf(stdout, "%s = %s\n", lv.name, scope.formatLocal(lv, loadConfig))
+	}
+}
+
+// formatLocal return the value of local variable, or the error like `(optimized out)`
+func (scope *evalScope) formatLocal(lv *localVariable, cfg LoadConfig) string {
+	v, err := scope.newLocalVariable(lv)
+	if err != nil {
+		return fmt.Sprintf("(%s)", err)
+	}
+	return v.format(cfg)
+}
+
+// findType finds the type by the name in go syntax, like `*main.Point`
+func (scope *evalScope) findType(name string) (dwarf.Type, error) {
+	switch name {
+	case "byte":
+		name = "uint8"
+	case "rune":
+		name = "int32"
+	}
+	for _, typeName := range []string{name, scope.packageName() + "." + name} {
+		if typ, err := scope.bi.findType(typeName); err == nil {
+			return typ, nil
+		}
+	}
+	if strings.HasPrefix(name, "*") {
+		elem, err := scope.findType(name[1:])
+		if err != nil {
+			return nil, err
+		}
+		return pointerTo(elem), nil
+	}
+	return nil, fmt.Errorf("can't find type %s", name)
+}
+
+// pointerTo return the pointer type of typ, the unnamed pointer type isn't in DWARF
+func pointerTo(typ dwarf.Type) dwarf.Type {
+	name := "*" + typeName(typ)
+	if ptr, err := target.bi.findType(name); err == nil {
+		return ptr
+	}
+	return &dwarf.PtrType{CommonType: dwarf.CommonType{ByteSize: 8, Name: name}, Type: typ}
+}
+
+// typeExprName return the type name of expression like `*main.Point`, it returns "" if node isn't a type
+func typeExprName(node ast.Expr) string {
+	switch node := node.(type) {
+	case *ast.Ident:
+		return node.Name
+	case *ast.ParenExpr:
+		return typeExprName(node.X)
+	case *ast.StarExpr:
+		if name := typeExprName(node.X); name != "" {
+			return "*" + name
+		}
+	case *ast.SelectorExpr:
+		if name := typeExprName(node.X); name != "" {
+			return name + "." + node.Sel.Name
+		}
+	case *ast.ArrayType:
+		if name := typeExprName(node.Elt); name != "" && node.Len == nil {
+			return "[]" + name
+		}
+	}
+	return ""
+}
+
+func (scope *evalScope) eval(node ast.Expr) (*Variable, error) {
+	switch node := node.(type) {
+	case *ast.ParenExpr:
+		return scope.eval(node.X)
+	case *ast.BasicLit:
+		value := constant.MakeFromLiteral(node.Value, node.Kind, 0)
+		if value.Kind() == constant.Unknown {
+			return nil, fmt.Errorf("invalid literal %s", node.Value)
+		}
+		return newConstant(value), nil
+	case *ast.Ident:
+		switch node.Name {
+		case "nil":
+			return &Variable{name: "nil", value: constant.MakeUint64(0)}, nil
+		case "true", "false":
+			return newConstant(constant.MakeBool(node.Name == "true")), nil
+		}
+		return scope.findVariable(node.Name)
+	case *ast.SelectorExpr:
+		// the package variable like `runtime.allgs`
+		if ident, ok := node.X.(*ast.Ident); ok {
+			if _, err := scope.findVariable(ident.Name); err != nil {
+				return scope.findVariable(ident.Name + "." + node.Sel.Name)
+			}
+		}
+		x, err := scope.eval(node.X)
+		if err != nil {
+			return nil, err
+		}
+		return x.structMember(node.Sel.Name)
+	case *ast.StarExpr:
+		x, err := scope.eval(node.X)
+		if err != nil {
+			return nil, err
+		}
+		return x.deref()
+	case *ast.IndexExpr:
+		x, err := scope.eval(node.X)
+		if err != nil {
+			return nil, err
+		}
+		index, err := scope.eval(node.Index)
+		if err != nil {
+			return nil, err
+		}
+		return x.index(index)
+	case *ast.SliceExpr:
+		return scope.evalSlice(node)
+	case *ast.UnaryExpr:
+		x, err := scope.eval(node.X)
+		if err != nil {
+			return nil, err
+		}
+		return scope.evalUnary(node.Op, x)
+	case *ast.BinaryExpr:
+		x, err := scope.eval(node.X)
+		if err != nil {
+			return nil, err
+		}
+		// the right operand isn't evaluated if the left decides the result, like `p != nil && p.x > 0`
+		if node.Op == token.LAND || node.Op == token.LOR {
+			xv, err := x.constantValue()
+			if err != nil {
+				return nil, err
+			}
+			if xv.Kind() != constant.Bool {
+				return nil, fmt.Errorf("invalid operation %s %s", xv, node.Op)
+			}
+			if constant.BoolVal(xv) == (node.Op == token.LOR) {
+				return newConstant(xv), nil
+			}
+		}
+		y, err := scope.eval(node.Y)
+		if err != nil {
+			return nil, err
+		}
+		return evalBinary(node.Op, x, y)
+	case *ast.CallExpr:
+		return scope.evalCall(node)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", node)
+}
+
+// newConstant return the untyped constant
+func newConstant(value constant.Value) *Variable {
+	return &Variable{value: value}
+}
+
+// newTypedValue return the value of typ which isn't in memory
+func newTypedValue(value constant.Value, typ dwarf.Type) (*Variable, error) {
+	size := typ.Size()
+	data := make([]byte, size)
+	orig := value
+	switch resolveTypedef(typ).(type) {
+	case *dwarf.BoolType:
+		if value.Kind() != constant.Bool {
+			return nil, fmt.Errorf("can't convert %s to %s", orig, typeName(typ))
+		}
+		if constant.BoolVal(value) {
+			data[0] = 1
+		}
+	case *dwarf.IntType, *dwarf.UintType, *dwarf.CharType, *dwarf.UcharType, *dwarf.PtrType, *dwarf.FuncType:
+		// the float is truncated like conversion `int(f)`
+		if value.Kind() == constant.Float {
+			f, _ := constant.Float64Val(value)
+			value = constant.MakeFloat64(math.Trunc(f))
+		}
+		value = constant.ToInt(value)
+		if value.Kind() != constant.Int {
+			return nil, fmt.Errorf("can't convert %s to %s", orig, typeName(typ))
+		}
+		var n uint64
+		if i, exact := constant.Int64Val(value); exact {
+			n = uint64(i)
+		} else {
+			n, _ = constant.Uint64Val(value)
+		}
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, n)
+		copy(data, buf)
+	case *dwarf.FloatType:
+		value = constant.ToFloat(value)
+		if value.Kind() != constant.Float && value.Kind() != constant.Int {
+			return nil, fmt.Errorf("can't convert %s to %s", orig, typeName(typ))
+		}
+		f, _ := constant.Float64Val(value)
+		if size == 4 {
+			binary.LittleEndian.PutUint32(data, math.Float32bits(float32(f)))
+		} else {
+			binary.LittleEndian.PutUint64(data, math.Float64bits(f))
+		}
+	case *dwarf.ComplexType:
+		value = constant.ToComplex(value)
+		if value.Kind() != constant.Complex {
+			return nil, fmt.Errorf("can't convert %s to %s", orig, typeName(typ))
+		}
+		re, _ := constant.Float64Val(constant.Real(value))
+		im, _ := constant.Float64Val(constant.Imag(value))
+		if size == 8 {
+			binary.LittleEndian.PutUint32(data, math.Float32bits(float32(re)))
+			binary.LittleEndian.PutUint32(data[4:], math.Float32bits(float32(im)))
+		} else {
+			binary.LittleEndian.PutUint64(data, math.Float64bits(re))
+			binary.LittleEndian.PutUint64(data[8:], math.Float64bits(im))
+		}
+	default:
+		return nil, fmt.Errorf("can't convert %s to %s", orig, typeName(typ))
+	}
+	return &Variable{typ: typ, data: data}, nil
+}
+
+// constantValue reads the value of basic type, the pointer is read as its address
+func (v *Variable) constantValue() (constant.Value, error) {
+	if v.value != nil {
+		return v.value, nil
+	}
+	switch typ := resolveTypedef(v.typ).(type) {
+	case *dwarf.BoolType:
+		buf, err := v.bytes()
+		if err != nil {
+			return nil, err
+		}
+		return constant.MakeBool(buf[0] != 0), nil
+	case *dwarf.IntType, *dwarf.CharType:
+		n, err := v.int()
+		if err != nil {
+			return nil, err
+		}
+		return constant.MakeInt64(n), nil
+	case *dwarf.UintType, *dwarf.UcharType, *dwarf.PtrType, *dwarf.FuncType:
+		n, err := v.uint()
+		if err != nil {
+			return nil, err
+		}
+		return constant.MakeUint64(n), nil
+	case *dwarf.FloatType:
+		buf, err := v.bytes()
+		if err != nil {
+			return nil, err
+		}
+		if len(buf) == 4 {
+			return constant.MakeFloat64(float64(math.Float32frombits(binary.LittleEndian.Uint32(buf)))), nil
+		}
+		return constant.MakeFloat64(math.Float64frombits(binary.LittleEndian.Uint64(buf))), nil
+	case *dwarf.ComplexType:
+		buf, err := v.bytes()
+		if err != nil {
+			return nil, err
+		}
+		half := len(buf) / 2
+		part := &dwarf.FloatType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: int64(half)}}}
+		re := &Variable{typ: part, data: buf[:half]}
+		im := &Variable{typ: part, data: buf[half:]}
+		rev, err := re.constantValue()
+		if err != nil {
+			return nil, err
+		}
+		imv, err := im.constantValue()
+		if err != nil {
+			return nil, err
+		}
+		return constant.BinaryOp(rev, token.ADD, constant.MakeImag(imv)), nil
+	case *dwarf.StructType:
+		if typ.StructName != "string" {
+			break
+		}
+		addr, err := v.uintField("str")
+		if err != nil {
+			return nil, err
+		}
+		length, err := v.uintField("len")
+		if err != nil {
+			return nil, err
+		}
+		if length > maxEvalStringLength {
+			return nil, fmt.Errorf("string is too long, len %d", length)
+		}
+		buf, err := target.readMemory(addr, int(length))
+		if err != nil {
+			return nil, err
+		}
+		return constant.MakeString(string(buf)), nil
+	}
+	return nil, fmt.Errorf("can't use %s as value", typeName(v.typ))
+}
+
+// structMember return the field of struct, the pointer to struct is dereferenced
+func (v *Variable) structMember(name string) (*Variable, error) {
+	if v.typ == nil {
+		return nil, fmt.Errorf("%s has no field %s", v.value, name)
+	}
+	if ptr, ok := resolveTypedef(v.typ).(*dwarf.PtrType); ok {
+		if _, ok := resolveTypedef(ptr.Type).(*dwarf.StructType); ok {
+			x, err := v.deref()
+			if err != nil {
+				return nil, err
+			}
+			return x.structMember(name)
+		}
+	}
+	st, ok := resolveTypedef(v.typ).(*dwarf.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%s has no field %s", typeName(v.typ), name)
+	}
+	field, err := structField(st, name)
+	if err != nil {
+		return nil, err
+	}
+	return v.child(name, field.ByteOffset, field.Type), nil
+}
+
+// deref return the value which the pointer points to
+func (v *Variable) deref() (*Variable, error) {
+	if v.typ == nil {
+		return nil, fmt.Errorf("invalid indirect of %s", v.value)
+	}
+	ptr, ok := resolveTypedef(v.typ).(*dwarf.PtrType)
+	if !ok || mapKind(v.typ) != "" {
+		return nil, fmt.Errorf("invalid indirect of %s", typeName(v.typ))
+	}
+	if _, ok := ptr.Type.(*dwarf.VoidType); ok || ptr.Type == nil {
+		return nil, errors.New("can't dereference unsafe.Pointer")
+	}
+	addr, err := v.uint()
+	if err != nil {
+		return nil, err
+	}
+	if addr == 0 {
+		return nil, errors.New("nil pointer dereference")
+	}
+	return newVariable("*"+v.name, addr, ptr.Type), nil
+}
+
+// int64Value reads the integer used as index or length
+func (v *Variable) int64Value() (int64, error) {
+	value, err := v.constantValue()
+	if err != nil {
+		return 0, err
+	}
+	n, exact := constant.Int64Val(constant.ToInt(value))
+	if !exact {
+		return 0, fmt.Errorf("%s isn't integer", value)
+	}
+	return n, nil
+}
+
+// elements return the address, the length and the element type of array, slice and string
+func (v *Variable) elements() (*Variable, int64, int64, dwarf.Type, error) {
+	if v.typ == nil {
+		return nil, 0, 0, nil, fmt.Errorf("can't index %s", v.value)
+	}
+	switch typ := resolveTypedef(v.typ).(type) {
+	case *dwarf.ArrayType:
+		return v, typ.Count, typ.Count, typ.Type, nil
+	case *dwarf.PtrType:
+		if array, ok := resolveTypedef(typ.Type).(*dwarf.ArrayType); ok {
+			x, err := v.deref()
+			if err != nil {
+				return nil, 0, 0, nil, err
+			}
+			return x, array.Count, array.Count, array.Type, nil
+		}
+	case *dwarf.StructType:
+		if typ.StructName == "string" || strings.HasPrefix(typ.StructName, "[]") {
+			ptrField := "array"
+			if typ.StructName == "string" {
+				ptrField = "str"
+			}
+			addr, err := v.uintField(ptrField)
+			if err != nil {
+				return nil, 0, 0, nil, err
+			}
+			length, err := v.uintField("len")
+			if err != nil {
+				return nil, 0, 0, nil, err
+			}
+			capacity := length
+			var elem dwarf.Type
+			if typ.StructName == "string" {
+				elem = resolveTypedef(typ.Field[0].Type).(*dwarf.PtrType).Type
+			} else {
+				if capacity, err = v.uintField("cap"); err != nil {
+					return nil, 0, 0, nil, err
+				}
+				field, err := structField(typ, "array")
+				if err != nil {
+					return nil, 0, 0, nil, err
+				}
+				elem = resolveTypedef(field.Type).(*dwarf.PtrType).Type
+			}
+			return newVariable("", addr, elem), int64(length), int64(capacity), elem, nil
+		}
+	}
+	return nil, 0, 0, nil, fmt.Errorf("can't index %s", typeName(v.typ))
+}
+
+// index return the element of array, slice, string or map
+func (v *Variable) index(index *Variable) (*Variable, error) {
+	if v.typ != nil && mapKind(v.typ) != "" {
+		return v.mapIndex(index)
+	}
+	base, length, _, elem, err := v.elements()
+	if err != nil {
+		return nil, err
+	}
+	i, err := index.int64Value()
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= length {
+		return nil, fmt.Errorf("index out of range [%d] with length %d", i, length)
+	}
+	return base.child(fmt.Sprintf("%s[%d]", v.name, i), i*elem.Size(), elem), nil
+}
+
+// mapIndex finds the value of key in map, the key is compared by its value
+func (v *Variable) mapIndex(key *Variable) (*Variable, error) {
+	want, err := key.constantValue()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		found   *Variable
+		walkErr error
+	)
+	err = v.walkMap(func(k, value *Variable) bool {
+		got, err := k.constantValue()
+		if err != nil {
+			walkErr = err
+			return false
+		}
+		if got.Kind() == want.Kind() || (got.Kind() != constant.String && want.Kind() != constant.String) {
+			if constant.Compare(got, token.EQL, want) {
+				found = value
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	if found == nil {
+		return nil, fmt.Errorf("can't find key %s in map", want)
+	}
+	return found, nil
+}
+
+// evalSlice evaluates `x[lo:hi]` of array, slice and string
+func (scope *evalScope) evalSlice(node *ast.SliceExpr) (*Variable, error) {
+	x, err := scope.eval(node.X)
+	if err != nil {
+		return nil, err
+	}
+	base, length, capacity, elem, err := x.elements()
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := int64(0), length
+	if node.Low != nil {
+		if lo, err = scope.evalInt(node.Low); err != nil {
+			return nil, err
+		}
+	}
+	if node.High != nil {
+		if hi, err = scope.evalInt(node.High); err != nil {
+			return nil, err
+		}
+	}
+	if node.Slice3 {
+		return nil, errors.New("unsupported 3-index slice")
+	}
+	if lo < 0 || hi < lo || hi > capacity {
+		return nil, fmt.Errorf("slice bounds out of range [%d:%d] with capacity %d", lo, hi, capacity)
+	}
+
+	typ := x.typ
+	if st, ok := resolveTypedef(typ).(*dwarf.StructType); !ok || (st.StructName != "string" && !strings.HasPrefix(st.StructName, "[]")) {
+		// the array is sliced to []T
+		if typ, err = scope.findType("[]" + typeName(elem)); err != nil {
+			return nil, err
+		}
+	}
+	// string is { str *uint8; len int }, slice is { array *T; len int; cap int }
+	data := make([]byte, typ.Size())
+	binary.LittleEndian.PutUint64(data, base.addr+uint64(lo*elem.Size()))
+	binary.LittleEndian.PutUint64(data[8:], uint64(hi-lo))
+	if len(data) >= 24 {
+		binary.LittleEndian.PutUint64(data[16:], uint64(capacity-lo))
+	}
+	return &Variable{name: x.name, typ: typ, data: data}, nil
+}
+
+func (scope *evalScope) evalInt(node ast.Expr) (int64, error) {
+	v, err := scope.eval(node)
+	if err != nil {
+		return 0, err
+	}
+	return v.int64Value()
+}
+
+func (scope *evalScope) evalUnary(op token.Token, x *Variable) (*Variable, error) {
+	if op == token.AND {
+		if x.typ == nil || x.data != nil || x.addr == 0 {
+			return nil, errors.New("can't take the address of value which isn't in memory")
+		}
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint64(data, x.addr)
+		return &Variable{name: "&" + x.name, typ: pointerTo(x.typ), data: data}, nil
+	}
+	value, err := x.constantValue()
+	if err != nil {
+		return nil, err
+	}
+	var prec uint
+	if x.typ != nil {
+		if _, ok := resolveTypedef(x.typ).(*dwarf.UintType); ok {
+			prec = uint(x.typ.Size() * 8)
+		}
+	}
+	switch op {
+	case token.SUB, token.ADD, token.XOR, token.NOT:
+		if op == token.NOT && value.Kind() != constant.Bool {
+			return nil, fmt.Errorf("invalid operation !%s", value)
+		}
+		result := constant.UnaryOp(op, value, prec)
+		if x.typ == nil {
+			return newConstant(result), nil
+		}
+		return newTypedValue(result, x.typ)
+	}
+	return nil, fmt.Errorf("unsupported operator %s", op)
+}
+
+func evalBinary(op token.Token, x, y *Variable) (*Variable, error) {
+	xv, err := x.constantValue()
+	if err != nil {
+		return nil, err
+	}
+	yv, err := y.constantValue()
+	if err != nil {
+		return nil, err
+	}
+	// the result is typed if any operand is typed
+	typ := x.typ
+	if typ == nil {
+		typ = y.typ
+	} else if y.typ != nil && typeName(x.typ) != typeName(y.typ) {
+		return nil, fmt.Errorf("mismatched types %s and %s", typeName(x.typ), typeName(y.typ))
+	}
+
+	switch op {
+	case token.LAND, token.LOR:
+		if xv.Kind() != constant.Bool || yv.Kind() != constant.Bool {
+			return nil, fmt.Errorf("invalid operation %s %s %s", xv, op, yv)
+		}
+		if op == token.LAND {
+			return newConstant(constant.MakeBool(constant.BoolVal(xv) && constant.BoolVal(yv))), nil
+		}
+		return newConstant(constant.MakeBool(constant.BoolVal(xv) || constant.BoolVal(yv))), nil
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		if (xv.Kind() == constant.String) != (yv.Kind() == constant.String) {
+			return nil, fmt.Errorf("mismatched types of %s and %s", xv, yv)
+		}
+		return newConstant(constant.MakeBool(constant.Compare(xv, op, yv))), nil
+	case token.SHL, token.SHR:
+		s, exact := constant.Uint64Val(constant.ToInt(yv))
+		if !exact {
+			return nil, fmt.Errorf("invalid shift count %s", yv)
+		}
+		if x.typ == nil {
+			return newConstant(constant.Shift(xv, op, uint(s))), nil
+		}
+		return newTypedValue(constant.Shift(xv, op, uint(s)), x.typ)
+	case token.ADD, token.SUB, token.MUL, token.QUO, token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+		if xv.Kind() == constant.String || yv.Kind() == constant.String {
+			return nil, fmt.Errorf("unsupported operation %s %s %s", xv, op, yv)
+		}
+		// integer division truncates
+		if op == token.QUO && isIntegerValue(x, xv) && isIntegerValue(y, yv) {
+			op = token.QUO_ASSIGN
+		}
+		if (op == token.QUO || op == token.QUO_ASSIGN || op == token.REM) && constant.Sign(yv) == 0 {
+			return nil, errors.New("division by zero")
+		}
+		result := constant.BinaryOp(xv, op, yv)
+		if typ == nil {
+			return newConstant(result), nil
+		}
+		return newTypedValue(result, typ)
+	}
+	return nil, fmt.Errorf("unsupported operator %s", op)
+}
+
+// isIntegerValue reports whether the variable is integer, the untyped constant like `7` is integer too
+func isIntegerValue(v *Variable, value constant.Value) bool {
+	if v.typ == nil {
+		return value.Kind() == constant.Int
+	}
+	switch resolveTypedef(v.typ).(type) {
+	case *dwarf.IntType, *dwarf.UintType, *dwarf.CharType, *dwarf.UcharType:
+		return true
+	}
+	return false
+}
+
+// evalCall evaluates the builtin `len` and `cap`, and the conversion like `(*T)(0xc000010000)`
+func (scope *evalScope) evalCall(node *ast.CallExpr) (*Variable, error) {
+	if len(node.Args) != 1 {
+		return nil, fmt.Errorf("unsupported call %s", typeExprName(node.Fun))
+	}
+	x, err := scope.eval(node.Args[0])
+	if err != nil {
+		return nil, err
+	}
+	if ident, ok := node.Fun.(*ast.Ident); ok && (ident.Name == "len" || ident.Name == "cap") {
+		intType, err := scope.findType("int")
+		if err != nil {
+			return nil, err
+		}
+		n, err := x.lenOrCap(ident.Name)
+		if err != nil {
+			return nil, err
+		}
+		return newTypedValue(constant.MakeInt64(n), intType)
+	}
+
+	name := typeExprName(node.Fun)
+	if name == "" {
+		return nil, errors.New("unsupported call, only len, cap and conversion are supported")
+	}
+	typ, err := scope.findType(name)
+	if err != nil {
+		return nil, err
+	}
+	return x.convert(typ)
+}
+
+// lenOrCap return the builtin len or cap of variable
+func (v *Variable) lenOrCap(fn string) (int64, error) {
+	if v.typ != nil && mapKind(v.typ) != "" && fn == "len" {
+		_, count, err := v.mapLen()
+		return int64(count), err
+	}
+	if v.typ != nil {
+		if ptr, ok := resolveTypedef(v.typ).(*dwarf.PtrType); ok {
+			if st, ok := resolveTypedef(ptr.Type).(*dwarf.StructType); ok && strings.HasPrefix(st.StructName, "hchan<") {
+				addr, err := v.uint()
+				if err != nil || addr == 0 {
+					return 0, err
+				}
+				field := map[string]string{"len": "qcount", "cap": "dataqsiz"}[fn]
+				n, err := newVariable("", addr, ptr.Type).uintField(field)
+				return int64(n), err
+			}
+		}
+	}
+	if v.value != nil && v.value.Kind() == constant.String && fn == "len" {
+		return int64(len(constant.StringVal(v.value))), nil
+	}
+	_, length, capacity, _, err := v.elements()
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument for %s", fn)
+	}
+	if fn == "cap" {
+		return capacity, nil
+	}
+	return length, nil
+}
+
+// convert return the value converted to typ
+func (v *Variable) convert(typ dwarf.Type) (*Variable, error) {
+	switch resolveTypedef(typ).(type) {
+	case *dwarf.BoolType, *dwarf.IntType, *dwarf.UintType, *dwarf.CharType, *dwarf.UcharType,
+		*dwarf.FloatType, *dwarf.ComplexType, *dwarf.PtrType, *dwarf.FuncType:
+		value, err := v.constantValue()
+		if err != nil {
+			return nil, err
+		}
+		if value.Kind() == constant.String {
+			return nil, fmt.Errorf("can't convert string to %s", typeName(typ))
+		}
+		return newTypedValue(value, typ)
+	}
+	// the named type is converted to the type with the same layout
+	if v.typ != nil && v.typ.Size() == typ.Size() {
+		return &Variable{name: v.name, addr: v.addr, typ: typ, data: v.data}, nil
+	}
+	return nil, fmt.Errorf("can't convert %s to %s", v.format(loadConfig), typeName(typ))
+}
+
+// evalAssign evaluates `lhs = rhs` of set command, the value is written to the memory of lhs
+func (scope *evalScope) evalAssign(expr string) (*Variable, error) {
+	lhsExpr, rhsExpr, err := splitAssign(expr)
+	if err != nil {
+		return nil, err
+	}
+	lhs, err := scope.evalString(lhsExpr)
+	if err != nil {
+		return nil, err
+	}
+	rhs, err := scope.evalString(rhsExpr)
+	if err != nil {
+		return nil, err
+	}
+	return lhs, lhs.assign(rhs)
+}
+
+// splitAssign splits `lhs = rhs` at the `=` outside brackets
+func splitAssign(expr string) (string, string, error) {
+	var (
+		s     scanner.Scanner
+		fset  = token.NewFileSet()
+		file  = fset.AddFile("", fset.Base(), len(expr))
+		depth = 0
+	)
+	s.Init(file, []byte(expr), nil, 0)
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return "", "", errors.New("the assignment should be `<expr> = <value>`")
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.ASSIGN:
+			if depth == 0 {
+				off := file.Offset(pos)
+				return strings.TrimSpace(expr[:off]), strings.TrimSpace(expr[off+1:]), nil
+			}
+		}
+	}
+}
+
+// assign writes value to the variable, the value is checked against the type of variable
+func (v *Variable) assign(value *Variable) error {
+	if v.typ == nil || v.data != nil || v.addr == 0 {
+		return fmt.Errorf("can't assign to %s which isn't in memory", v.name)
+	}
+	data, err := value.assignableBytes(v.name, v.typ)
+	if err != nil {
+		return err
+	}
+	return target.writeMemory(v.addr, data)
+}
+
+// assignableBytes return the bytes of value which is assigned to name of typ, it's used by set and call
+func (value *Variable) assignableBytes(name string, typ dwarf.Type) ([]byte, error) {
+	if value.typ != nil && typeName(value.typ) != typeName(typ) {
+		return nil, fmt.Errorf("can't assign %s to %s of type %s", typeName(value.typ), name, typeName(typ))
+	}
+
+	switch resolveTypedef(typ).(type) {
+	case *dwarf.BoolType, *dwarf.IntType, *dwarf.UintType, *dwarf.CharType, *dwarf.UcharType,
+		*dwarf.FloatType, *dwarf.ComplexType:
+		c, err := value.constantValue()
+		if err != nil {
+			return nil, err
+		}
+		x, err := newTypedValue(c, typ)
+		if err != nil {
+			return nil, err
+		}
+		// the untyped constant must be represented by the type exactly, like Go compiler checks
+		if value.typ == nil && isIntegerValue(x, nil) {
+			if c.Kind() == constant.Float && constant.ToInt(c).Kind() != constant.Int {
+				return nil, fmt.Errorf("constant %s truncated to %s", c, typeName(typ))
+			}
+			if got, err := x.constantValue(); err != nil || constant.Compare(got, token.NEQ, constant.ToInt(c)) {
+				return nil, fmt.Errorf("constant %s overflows %s", c, typeName(typ))
+			}
+		}
+		return x.data, nil
+	}
+	switch {
+	case value.typ != nil:
+		// the same type is copied, like the pointer and the string header
+		return value.bytes()
+	case value.name == "nil" && isNilable(typ):
+		return make([]byte, typ.Size()), nil
+	case value.value != nil && value.value.Kind() == constant.Int && mapKind(typ) == "":
+		// the address is assigned to pointer, like `set p = 0xc000010000`
+		if _, ok := resolveTypedef(typ).(*dwarf.PtrType); ok {
+			x, err := newTypedValue(value.value, typ)
+			if err != nil {
+				return nil, err
+			}
+			return x.data, nil
+		}
+	}
+	return nil, fmt.Errorf("can't assign %s to %s of type %s", value.format(loadConfig), name, typeName(typ))
+}
+
+// isNilable reports whether nil can be assigned to the type, like pointer, map, chan, func, slice and interface
+func isNilable(typ dwarf.Type) bool {
+	switch typ := resolveTypedef(typ).(type) {
+	case *dwarf.PtrType, *dwarf.FuncType:
+		return true
+	case *dwarf.StructType:
+		return strings.HasPrefix(typ.StructName, "[]") || typ.StructName == "runtime.eface" || typ.StructName == "runtime.iface"
+	}
+	return false
+}
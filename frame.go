@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"go.uber.org/zap"
 	"io"
+	"strings"
 )
 
 // http://dwarfstd.org/doc/Dwarf3.pdf
@@ -18,6 +19,10 @@ type CommonInformationEntry struct {
 	data_alignment_factor   int64
 	return_address_register uint64
 	initial_instructions    []byte
+	// fdeEncoding is the pointer encoding of the FDE addresses, it's set by the augmentation 'R'
+	fdeEncoding byte
+	// hasAugmentationData is true if the augmentation starts with 'z', the FDEs have augmentation data too
+	hasAugmentationData bool
 	// `padding`, Enough DW_CFA_nop instructions to make the size of this entry match the length value above.
 }
 
@@ -40,6 +45,10 @@ type FrameDescriptionEntry struct {
 	CIE          *CommonInformationEntry
 	instructions []byte
 	begin, size  uint64
+	// instructionsAddr is the address of instructions in .eh_frame, the pc relative operand of DW_CFA_set_loc is based on it.
+	// staticBase is the load bias of position-independent executable, which the absolute operand is moved by
+	instructionsAddr uint64
+	staticBase       uint64
 }
 
 func (fde *FrameDescriptionEntry) String() string {
@@ -63,9 +72,12 @@ type Frame struct {
 	Offset       int64
 	cfa          *DWRule
 	regsRule     map[uint64]DWRule
-	regs         []uint64
-	framebase    uint64
 	loc          uint64
+	fde          *FrameDescriptionEntry
+	// initialRules are the rules after the CIE instructions, DW_CFA_restore restores them
+	initialRules map[uint64]DWRule
+	// states are pushed by DW_CFA_remember_state, and popped by DW_CFA_restore_state
+	states []frameState
 }
 
 func parseFrameInformation(buffer *bytes.Buffer) (*VirtualUnwindFrameInformation, error) {
@@ -201,7 +213,12 @@ func parseCommonInformationEntryByte(len uint32, data []byte) (*CommonInformatio
 	if str, err = buf.ReadString(0x0); err != nil {
 		return nil, err
 	}
-	cie.augmentation = str
+	cie.augmentation = strings.TrimSuffix(str, "\x00")
+
+	// address_size and segment_selector_size are added in version 4
+	if cie.version >= 4 {
+		buf.Next(2)
+	}
 
 	// code_alignment_factor (unsigned LEB128)
 	if cie.code_alignment_factor, _, err = DecodeULEB128(buf); err != nil {
@@ -213,8 +230,18 @@ func parseCommonInformationEntryByte(len uint32, data []byte) (*CommonInformatio
 		return nil, err
 	}
 
-	// return_address_register (unsigned LEB128)
-	if cie.return_address_register, _, err = DecodeULEB128(buf); err != nil {
+	// return_address_register is ubyte in version 1 of .eh_frame, unsigned LEB128 in others
+	if cie.version == 1 {
+		var b byte
+		if b, err = buf.ReadByte(); err != nil {
+			return nil, err
+		}
+		cie.return_address_register = uint64(b)
+	} else if cie.return_address_register, _, err = DecodeULEB128(buf); err != nil {
+		return nil, err
+	}
+
+	if err = parseAugmentation(cie, buf); err != nil {
 		return nil, err
 	}
 
@@ -231,7 +258,7 @@ func parseFrameDescriptionEntryByte(len uint32, data []byte) (*FrameDescriptionE
 	fde := &FrameDescriptionEntry{}
 
 	fde.length = len
-	fde.begin = binary.LittleEndian.Uint64(data[:8]) // + ctx.staticBase
+	fde.begin = binary.LittleEndian.Uint64(data[:8]) // relocated by BI.relocate for the position-independent executable
 	fde.size = binary.LittleEndian.Uint64(data[8:16])
 	fde.instructions = data[16:]
 
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"syscall"
+)
+
+// the status of goroutine, copy from runtime/runtime2.go
+const (
+	gIdle      = 0
+	gRunnable  = 1
+	gRunning   = 2
+	gSyscall   = 3
+	gWaiting   = 4
+	gDead      = 6
+	gCopystack = 8
+	gPreempted = 9
+	gScan      = 0x1000
+)
+
+var gStatusNames = map[uint32]string{
+	gIdle:      "idle",
+	gRunnable:  "runnable",
+	gRunning:   "running",
+	gSyscall:   "syscall",
+	gWaiting:   "waiting",
+	gDead:      "dead",
+	gCopystack: "copystack",
+	gPreempted: "preempted",
+}
+
+// Goroutine is read from `runtime.allgs` of the process
+type Goroutine struct {
+	id         uint64
+	addr       uint64
+	status     uint32
+	waitReason string
+
+	// pc, sp and bp are saved in `g.sched` when the goroutine is parked
+	pc, sp, bp uint64
+	// stackLo and stackHi are the bounds of goroutine stack, it's moved when the stack grows
+	stackLo, stackHi uint64
+
+	// thread is running the goroutine, the registers should be read from it rather than `g.sched`
+	thread *Thread
+}
+
+func (g *Goroutine) statusString() string {
+	if name, ok := gStatusNames[g.status&^gScan]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", g.status)
+}
+
+// gLayout is the offsets of `runtime.g` fields used by godbg
+type gLayout struct {
+	size                      int64
+	goid, status, waitReason  int64
+	schedPc, schedSp, schedBp int64
+	stackLo, stackHi          int64
+}
+
+// runtimeGLayout finds the offsets of `runtime.g` by the type of `runtime.allgs`
+func (bi *BI) runtimeGLayout() (*gLayout, error) {
+	_, typ, err := bi.findGlobalVariable("runtime.allgs")
+	if err != nil {
+		return nil, err
+	}
+	// []*runtime.g is described by struct { array **runtime.g; len int; cap int }
+	slice, ok := resolveTypedef(typ).(*dwarf.StructType)
+	if !ok || len(slice.Field) == 0 {
+		return nil, fmt.Errorf("unexpected type %s of runtime.allgs", typ)
+	}
+	typ = slice.Field[0].Type
+	for i := 0; i < 2; i++ {
+		ptr, ok := resolveTypedef(typ).(*dwarf.PtrType)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type %s of runtime.allgs", typ)
+		}
+		typ = ptr.Type
+	}
+	g, ok := resolveTypedef(typ).(*dwarf.StructType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s of runtime.g", typ)
+	}
+
+	layout := &gLayout{size: g.ByteSize}
+	fieldOffset := func(st *dwarf.StructType, names ...string) (int64, error) {
+		offset := int64(0)
+		for _, name := range names {
+			field, err := structField(st, name)
+			if err != nil {
+				return 0, err
+			}
+			offset += field.ByteOffset
+			st, _ = resolveTypedef(field.Type).(*dwarf.StructType)
+		}
+		return offset, nil
+	}
+	if layout.goid, err = fieldOffset(g, "goid"); err != nil {
+		return nil, err
+	}
+	if layout.waitReason, err = fieldOffset(g, "waitreason"); err != nil {
+		return nil, err
+	}
+	// atomicstatus is `atomic.Uint32` since go1.20, it was `uint32` before
+	if layout.status, err = fieldOffset(g, "atomicstatus", "value"); err != nil {
+		if layout.status, err = fieldOffset(g, "atomicstatus"); err != nil {
+			return nil, err
+		}
+	}
+	if layout.schedPc, err = fieldOffset(g, "sched", "pc"); err != nil {
+		return nil, err
+	}
+	if layout.schedSp, err = fieldOffset(g, "sched", "sp"); err != nil {
+		return nil, err
+	}
+	if layout.schedBp, err = fieldOffset(g, "sched", "bp"); err != nil {
+		return nil, err
+	}
+	if layout.stackLo, err = fieldOffset(g, "stack", "lo"); err != nil {
+		return nil, err
+	}
+	if layout.stackHi, err = fieldOffset(g, "stack", "hi"); err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+// goroutines return all goroutines except the dead ones
+func (t *Target) goroutines() ([]*Goroutine, error) {
+	layout, err := t.bi.runtimeGLayout()
+	if err != nil {
+		return nil, err
+	}
+	allgsAddr, _, err := t.bi.findGlobalVariable("runtime.allgs")
+	if err != nil {
+		return nil, err
+	}
+	header, err := t.readMemory(allgsAddr, 16)
+	if err != nil {
+		return nil, err
+	}
+	array, length := binary.LittleEndian.Uint64(header[:8]), binary.LittleEndian.Uint64(header[8:])
+	ptrs, err := t.readMemory(array, int(length)*8)
+	if err != nil {
+		return nil, err
+	}
+
+	// the current g of thread is stored at -8(FS)
+	threadOfG := make(map[uint64]*Thread, len(t.threads))
+	for _, thread := range t.threads {
+		var regs syscall.PtraceRegs
+		if err = syscall.PtraceGetRegs(thread.tid, &regs); err != nil {
+			return nil, err
+		}
+		if gaddr, err := t.readUint64(regs.Fs_base - 8); err == nil && gaddr != 0 {
+			threadOfG[gaddr] = thread
+		}
+	}
+
+	gs := make([]*Goroutine, 0, length)
+	for i := uint64(0); i < length; i++ {
+		addr := binary.LittleEndian.Uint64(ptrs[i*8:])
+		if addr == 0 {
+			continue
+		}
+		buf, err := t.readMemory(addr, int(layout.size))
+		if err != nil {
+			return nil, err
+		}
+		g := &Goroutine{
+			id:      binary.LittleEndian.Uint64(buf[layout.goid:]),
+			addr:    addr,
+			status:  binary.LittleEndian.Uint32(buf[layout.status:]),
+			pc:      binary.LittleEndian.Uint64(buf[layout.schedPc:]),
+			sp:      binary.LittleEndian.Uint64(buf[layout.schedSp:]),
+			bp:      binary.LittleEndian.Uint64(buf[layout.schedBp:]),
+			stackLo: binary.LittleEndian.Uint64(buf[layout.stackLo:]),
+			stackHi: binary.LittleEndian.Uint64(buf[layout.stackHi:]),
+			thread:  threadOfG[addr],
+		}
+		if g.status&^gScan == gDead {
+			continue
+		}
+		if g.status&^gScan == gWaiting {
+			g.waitReason = t.waitReasonString(buf[layout.waitReason])
+		}
+		gs = append(gs, g)
+	}
+	return gs, nil
+}
+
+// waitReasonString reads the wait reason from `runtime.waitReasonStrings`
+func (t *Target) waitReasonString(reason uint8) string {
+	addr, typ, err := t.bi.findGlobalVariable("runtime.waitReasonStrings")
+	if err != nil {
+		return fmt.Sprintf("%d", reason)
+	}
+	if array, ok := resolveTypedef(typ).(*dwarf.ArrayType); !ok || int64(reason) >= array.Count {
+		return fmt.Sprintf("%d", reason)
+	}
+	header, err := t.readMemory(addr+uint64(reason)*16, 16)
+	if err != nil {
+		return fmt.Sprintf("%d", reason)
+	}
+	str, err := t.readMemory(binary.LittleEndian.Uint64(header[:8]), int(binary.LittleEndian.Uint64(header[8:])))
+	if err != nil {
+		return fmt.Sprintf("%d", reason)
+	}
+	return string(str)
+}
+
+// location return the pc of goroutine, it's the pc of thread if the goroutine is running
+func (g *Goroutine) location() (uint64, error) {
+	if g.thread == nil {
+		return g.pc, nil
+	}
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(g.thread.tid, &regs); err != nil {
+		return 0, err
+	}
+	return regs.PC(), nil
+}
+
+// isCurGoroutine reports whether the goroutine is selected, or is running on the current thread
+func (t *Target) isCurGoroutine(g *Goroutine) bool {
+	if t.curGoroutine != nil {
+		return t.curGoroutine.id == g.id
+	}
+	return g.thread != nil && g.thread == t.curThread
+}
+
+// switchGoroutine selects the goroutine, the thread running it becomes the current thread
+func (t *Target) switchGoroutine(id uint64) error {
+	gs, err := t.goroutines()
+	if err != nil {
+		return err
+	}
+	for _, g := range gs {
+		if g.id != id {
+			continue
+		}
+		if g.thread != nil {
+			if err = t.switchThread(g.thread.tid); err != nil {
+				return err
+			}
+		}
+		t.curGoroutine, t.curFrame = g, 0
+		return nil
+	}
+	return fmt.Errorf("can't find goroutine %d", id)
+}
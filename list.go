@@ -11,7 +11,7 @@ import (
 )
 
 func listFileLineByPtracePc(bi *BI, rangeline int) error {
-	pc, err := getPtracePc()
+	pc, err := target.selectedPc()
 	if err != nil {
 		return err
 	}
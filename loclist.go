@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// the kinds of location list entry in .debug_loclists, see DWARF 5 7.7.3
+const (
+	DW_LLE_end_of_list      = 0x00
+	DW_LLE_base_addressx    = 0x01
+	DW_LLE_startx_endx      = 0x02
+	DW_LLE_startx_length    = 0x03
+	DW_LLE_offset_pair      = 0x04
+	DW_LLE_default_location = 0x05
+	DW_LLE_base_address     = 0x06
+	DW_LLE_start_end        = 0x07
+	DW_LLE_start_length     = 0x08
+)
+
+// the unit types of DWARF 5 whose headers have extra fields, see DWARF 5 7.5.1
+const (
+	DW_UT_type          = 0x02
+	DW_UT_skeleton      = 0x04
+	DW_UT_split_compile = 0x05
+	DW_UT_split_type    = 0x06
+)
+
+// openDebugSection return the data of section, it's nil if the section doesn't exist
+func openDebugSection(elffile *elf.File, name string) ([]byte, error) {
+	section := elffile.Section(name)
+	if section == nil {
+		section = elffile.Section(".z" + name[1:])
+	}
+	if section == nil {
+		return nil, nil
+	}
+	return section.Data()
+}
+
+// locationExpr return the location expression of variable at pc.
+// The variable of optimized binary is described by location list, OptimizedOutErr is returned when no entry covers pc.
+func (bi *BI) locationExpr(entry *dwarf.Entry, cu *CompileUnit, pc uint64) ([]byte, error) {
+	field := entry.AttrField(dwarf.AttrLocation)
+	if field == nil {
+		return nil, OptimizedOutErr
+	}
+	var (
+		expr []byte
+		err  error
+	)
+	switch field.Class {
+	case dwarf.ClassExprLoc, dwarf.ClassBlock:
+		expr, _ = field.Val.([]byte)
+	case dwarf.ClassLocListPtr, dwarf.ClassLocList:
+		var off uint64
+		switch val := field.Val.(type) {
+		case int64:
+			off = uint64(val)
+		case uint64:
+			off = val
+		default:
+			return nil, fmt.Errorf("unexpected location list offset %v", field.Val)
+		}
+		// DW_FORM_loclistx is the index of offsets table at DW_AT_loclists_base
+		if field.Class == dwarf.ClassLocList {
+			if off, err = bi.loclistsOffset(cu, off); err != nil {
+				return nil, err
+			}
+		}
+		// the addresses of location list aren't relocated.
+		// The binary may mix DWARF 5 of go and DWARF 4 of cgo, so the section is chosen by the unit
+		pc -= bi.staticBase
+		if cu.version >= 5 {
+			expr, err = bi.findLoclists(off, cu, pc)
+		} else {
+			expr, err = bi.findLoc(off, cu, pc)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported location class %s", field.Class)
+	}
+	// the empty expression means the variable has no location
+	if err == nil && len(expr) == 0 {
+		err = OptimizedOutErr
+	}
+	return expr, err
+}
+
+// findLoc searches the location list of DWARF 4 in .debug_loc
+func (bi *BI) findLoc(off uint64, cu *CompileUnit, pc uint64) ([]byte, error) {
+	if off >= uint64(len(bi.loc)) {
+		return nil, fmt.Errorf("location list offset 0x%x is out of .debug_loc", off)
+	}
+	base := cu.lowpc
+	buf := bytes.NewBuffer(bi.loc[off:])
+	for {
+		b := buf.Next(16)
+		if len(b) != 16 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		begin, end := binary.LittleEndian.Uint64(b), binary.LittleEndian.Uint64(b[8:])
+		if begin == 0 && end == 0 {
+			return nil, OptimizedOutErr
+		}
+		// the base address selection entry
+		if begin == ^uint64(0) {
+			base = end
+			continue
+		}
+		b = buf.Next(2)
+		if len(b) != 2 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		expr := buf.Next(int(binary.LittleEndian.Uint16(b)))
+		if base+begin <= pc && pc < base+end {
+			return expr, nil
+		}
+	}
+}
+
+// findLoclists searches the location list of DWARF 5 in .debug_loclists
+func (bi *BI) findLoclists(off uint64, cu *CompileUnit, pc uint64) ([]byte, error) {
+	if off >= uint64(len(bi.loclists)) {
+		return nil, fmt.Errorf("location list offset 0x%x is out of .debug_loclists", off)
+	}
+	var (
+		base            = cu.lowpc
+		defaultLocation []byte
+		buf             = bytes.NewBuffer(bi.loclists[off:])
+	)
+	uleb := func() uint64 {
+		n, _, _ := DecodeULEB128(buf)
+		return n
+	}
+	addr := func() uint64 {
+		b := buf.Next(8)
+		if len(b) != 8 {
+			return 0
+		}
+		return binary.LittleEndian.Uint64(b)
+	}
+	for {
+		kind, err := buf.ReadByte()
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		var begin, end uint64
+		switch kind {
+		case DW_LLE_end_of_list:
+			if defaultLocation != nil {
+				return defaultLocation, nil
+			}
+			return nil, OptimizedOutErr
+		case DW_LLE_base_addressx:
+			if base, err = bi.debugAddr(cu, uleb()); err != nil {
+				return nil, err
+			}
+			continue
+		case DW_LLE_base_address:
+			base = addr()
+			continue
+		case DW_LLE_startx_endx:
+			if begin, err = bi.debugAddr(cu, uleb()); err != nil {
+				return nil, err
+			}
+			if end, err = bi.debugAddr(cu, uleb()); err != nil {
+				return nil, err
+			}
+		case DW_LLE_startx_length:
+			if begin, err = bi.debugAddr(cu, uleb()); err != nil {
+				return nil, err
+			}
+			end = begin + uleb()
+		case DW_LLE_offset_pair:
+			begin = base + uleb()
+			end = base + uleb()
+		case DW_LLE_default_location:
+		case DW_LLE_start_end:
+			begin, end = addr(), addr()
+		case DW_LLE_start_length:
+			begin = addr()
+			end = begin + uleb()
+		default:
+			return nil, fmt.Errorf("unknown location list entry 0x%x", kind)
+		}
+		expr := buf.Next(int(uleb()))
+		if kind == DW_LLE_default_location {
+			defaultLocation = expr
+			continue
+		}
+		if begin <= pc && pc < end {
+			return expr, nil
+		}
+	}
+}
+
+// loclistsOffset return the offset of location list at index of the offsets table in .debug_loclists
+func (bi *BI) loclistsOffset(cu *CompileUnit, index uint64) (uint64, error) {
+	size := uint64(4)
+	if cu.dwarf64 {
+		size = 8
+	}
+	off := cu.loclistsBase + index*size
+	if off+size > uint64(len(bi.loclists)) {
+		return 0, errors.New("location list index is out of .debug_loclists")
+	}
+	if size == 8 {
+		return cu.loclistsBase + binary.LittleEndian.Uint64(bi.loclists[off:]), nil
+	}
+	return cu.loclistsBase + uint64(binary.LittleEndian.Uint32(bi.loclists[off:])), nil
+}
+
+// debugAddr return the address at index of the compile unit in .debug_addr
+func (bi *BI) debugAddr(cu *CompileUnit, index uint64) (uint64, error) {
+	off := cu.addrBase + index*8
+	if off+8 > uint64(len(bi.addr)) {
+		return 0, errors.New("address index is out of .debug_addr")
+	}
+	return binary.LittleEndian.Uint64(bi.addr[off:]), nil
+}
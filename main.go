@@ -8,6 +8,8 @@ import (
 	"go.uber.org/zap"
 	"io"
 	"os"
+	"path"
+	"strconv"
 )
 
 var (
@@ -22,48 +24,124 @@ var (
 func main() {
 	var (
 		filename string
+		tids     []int
 		err      error
 		p        *prompt.Prompt
 	)
 	stdin = os.Stdin
 	stdout = os.Stdout
 	stderr = os.Stderr
-	target = &Target{bi: &BI{}, bp: &BP{}}
+	target = &Target{bi: &BI{}, bp: &BP{}, launch: &LaunchConfig{}}
 
-	if err = checkArgs(); err != nil {
+	if filename, target.launch, err = checkArgs(); err != nil {
 		logger.Error(err.Error(), zap.String("stage", "checkArgs"), zap.Strings("args", os.Args))
+		printErr(err)
 		printExecutableProgramHelper()
 		return
 	}
 
-	// step 1, get absolute filename
-	if filename, err = absoluteFilename(); err != nil {
-		logger.Error(err.Error(), zap.String("stage", "absolute"), zap.String("filename", filename))
-		printExecutableProgramHelper()
-		return
-	}
+	switch os.Args[1] {
+	case "attach":
+		pid, _ := strconv.Atoi(filename)
 
-	// step 2, build the filename into executable file
-	if target.execFile, err = build(filename); err != nil {
-		logger.Error(err.Error(), zap.String("stage", "build"), zap.String("filename", filename))
-		printExecutableProgramHelper()
-		return
-	}
-	defer os.Remove(target.execFile)
+		// step 1, find the executable file of the running process
+		if target.execFile, err = execFileOfPid(pid); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "execFileOfPid"), zap.Int("pid", pid))
+			printExecutableProgramHelper()
+			return
+		}
 
-	// step 3, analyze executable file; The most import places are "_debug_info", "_debug_line"
-	if target.bi, err = analyze(target.execFile); err != nil {
-		logger.Error(err.Error(), zap.String("stage", "analyze"),
-			zap.String("filename", filename), zap.String("execfile", target.execFile))
-		printExecutableProgramHelper()
-		return
+		// step 2, analyze executable file
+		if target.bi, err = analyze(target.execFile); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "analyze"), zap.String("execfile", target.execFile))
+			printExecutableProgramHelper()
+			return
+		}
+
+		// step 3, attach all threads of the process
+		if target.cmd, tids, err = attach(pid); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "attach"), zap.Int("pid", pid))
+			printErr(err)
+			return
+		}
+		target.attached = true
+	case "exec":
+		// step 1, get absolute filename
+		if filename, err = absoluteFilename(filename); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "absolute"), zap.String("filename", filename))
+			printExecutableProgramHelper()
+			return
+		}
+
+		// step 2, the executable file has been built, so just analyze it and keep it untouched
+		target.execFile = filename
+		if target.bi, err = analyze(target.execFile); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "analyze"), zap.String("execfile", target.execFile))
+			printExecutableProgramHelper()
+			return
+		}
+		if names := target.bi.optimizedCompileUnits(); len(names) > 0 {
+			printOptimizedWarning(names)
+		}
+
+		// step 3, run executable file with the arguments after `--`
+		if target.cmd, err = runexec(target.execFile, target.launch); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "runexec"), zap.String("execfile", target.execFile))
+			printExecutableProgramHelper()
+			return
+		}
+	default:
+		// step 1, get absolute filename, the package path like `github.com/x/y/cmd` is kept
+		if absfilename, err := absoluteFilename(filename); err == nil {
+			filename = absfilename
+		} else if path.Ext(filename) == ".go" {
+			logger.Error(err.Error(), zap.String("stage", "absolute"), zap.String("filename", filename))
+			printExecutableProgramHelper()
+			return
+		}
+
+		// step 2, build the filename, the directory or the package into executable file,
+		// `godbg test` builds the test binary
+		if os.Args[1] == "test" {
+			target.execFile, err = buildTest(filename, target.launch.buildFlags)
+		} else {
+			target.execFile, err = build(filename, target.launch.buildFlags)
+		}
+		if err != nil {
+			logger.Error(err.Error(), zap.String("stage", "build"), zap.String("filename", filename))
+			printErr(err)
+			return
+		}
+		// the executable file out of the build cache is removed when godbg quits
+		if !inBuildCache(target.execFile) {
+			target.removeExecFile = true
+			defer os.Remove(target.execFile)
+		}
+
+		// step 3, analyze executable file; The most import places are "_debug_info", "_debug_line"
+		if target.bi, err = analyze(target.execFile); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "analyze"),
+				zap.String("filename", filename), zap.String("execfile", target.execFile))
+			printExecutableProgramHelper()
+			return
+		}
+
+		// step 4, run executable file
+		if target.cmd, err = runexec(target.execFile, target.launch); err != nil {
+			logger.Error(err.Error(), zap.String("stage", "runexec"),
+				zap.String("filename", filename), zap.String("execfile", target.execFile))
+			printExecutableProgramHelper()
+			return
+		}
 	}
 
-	// step 4, run executable file
-	if target.cmd, err = runexec(target.execFile); err != nil {
-		logger.Error(err.Error(), zap.String("stage", "runexec"),
-			zap.String("filename", filename), zap.String("execfile", target.execFile))
-		printExecutableProgramHelper()
+	// trace all threads, the process is the only thread when it's started by godbg
+	if tids == nil {
+		tids = []int{target.cmd.Process.Pid}
+	}
+	if err = target.initThreads(tids); err != nil {
+		logger.Error(err.Error(), zap.String("stage", "initThreads"), zap.Ints("tids", tids))
+		printErr(err)
 		return
 	}
 	fmt.Fprintf(stdout, "trace cur process pid %d\n", target.cmd.Process.Pid)
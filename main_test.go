@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
 	"github.com/debugger101/godbg/log"
 	. "github.com/onsi/gomega"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path"
 	"strings"
 	"testing"
@@ -11,10 +17,12 @@ import (
 
 func clear_variable() {
 	target = &Target{
-		bi: &BI{},
-		bp: &BP{},
+		bi:     &BI{},
+		bp:     &BP{},
+		launch: &LaunchConfig{},
 	}
 	logger = log.Log
+	loadConfig = defaultLoadConfig()
 
 	stdin = os.Stdin
 	stdout = os.Stdout
@@ -22,6 +30,10 @@ func clear_variable() {
 }
 
 func build_run_debug(filename string) (string, error) {
+	return build_run_debug_flags(filename, nil)
+}
+
+func build_run_debug_flags(filename string, buildFlags []string) (string, error) {
 	var (
 		dir      string
 		execfile string
@@ -35,9 +47,10 @@ func build_run_debug(filename string) (string, error) {
 	filename = path.Join(dir, filename)
 
 	// step 2, build the filename into executable file
-	if execfile, err = build(filename); err != nil {
+	if execfile, err = build(filename, buildFlags); err != nil {
 		return "", err
 	}
+	target.execFile = execfile
 
 	// step 3, analyze executable file; The most import places are "_debug_info", "_debug_line"
 	if target.bi, err = analyze(execfile); err != nil {
@@ -45,7 +58,10 @@ func build_run_debug(filename string) (string, error) {
 	}
 
 	// step 4, run executable file
-	if target.cmd, err = runexec(execfile); err != nil {
+	if target.cmd, err = runexec(execfile, target.launch); err != nil {
+		return execfile, err
+	}
+	if err = target.initThreads([]int{target.cmd.Process.Pid}); err != nil {
 		return execfile, err
 	}
 
@@ -76,7 +92,7 @@ func TestBuild(t *testing.T) {
 	g.Expect(err).Should(BeNil())
 	filename = path.Join(dir, "./test_file/t1.go")
 
-	execfile, err = build(filename)
+	execfile, err = build(filename, nil)
 	g.Expect(err).Should(BeNil())
 	defer os.Remove(execfile)
 
@@ -325,7 +341,7 @@ func TestBreakClearContinue(t *testing.T) {
 	outw.Reset()
 
 	executor("bc 1")
-	g.Expect(outw.String()).Should(ContainSubstring("clear breakpoint 1 successfully, resort breakpoint again"))
+	g.Expect(outw.String()).Should(Equal("clear breakpoint 1 successfully\n"))
 	g.Expect(errw.String()).Should(Equal(""))
 	outw.Reset()
 
@@ -562,3 +578,1732 @@ func TestPrintString2(t *testing.T) {
 	executor("q")
 	clear_variable()
 }
+
+func TestAttachDetach(t *testing.T) {
+	var (
+		dir      string
+		execfile string
+		tids     []int
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	dir, err = os.Getwd()
+	g.Expect(err).Should(BeNil())
+	execfile, err = build(path.Join(dir, "./test_file/t7.go"), nil)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	running := exec.Command(execfile)
+	g.Expect(running.Start()).Should(BeNil())
+
+	target.execFile, err = execFileOfPid(running.Process.Pid)
+	g.Expect(err).Should(BeNil())
+	target.bi, err = analyze(target.execFile)
+	g.Expect(err).Should(BeNil())
+	target.cmd, tids, err = attach(running.Process.Pid)
+	g.Expect(err).Should(BeNil())
+	g.Expect(target.initThreads(tids)).Should(BeNil())
+	target.attached = true
+	g.Expect(os.Setenv("GODBG_TEST", "true")).Should(BeNil())
+
+	executor("b ./test_file/t7.go:8")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t7.go:8 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("detach")
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf("detach process %d successfully", running.Process.Pid)))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the user breakpoints are gone with their locations
+	executor("bl")
+	g.Expect(outw.String()).Should(ContainSubstring("there is no breakpoint"))
+
+	// the original bytes are restored, so the process exits normally
+	g.Expect(running.Wait()).Should(BeNil())
+
+	executor("q")
+	clear_variable()
+}
+
+func TestExecOptimizedWarning(t *testing.T) {
+	var (
+		dir      string
+		execfile string
+		bi       *BI
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	dir, err = os.Getwd()
+	g.Expect(err).Should(BeNil())
+	filename := path.Join(dir, "./test_file/t1.go")
+
+	// built by `godbg`, no warning
+	execfile, err = build(filename, nil)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(bi.optimizedCompileUnits()).Should(BeEmpty())
+
+	// built by the release pipeline
+	releasefile := path.Join(os.TempDir(), "__release_t1.go__")
+	g.Expect(exec.Command("go", "build", "-o", releasefile, filename).Run()).Should(BeNil())
+	defer os.Remove(releasefile)
+	bi, err = analyze(releasefile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(bi.optimizedCompileUnits()).Should(ContainElement("main"))
+	g.Expect(bi.optimizedCompileUnits()).ShouldNot(ContainElement("runtime"))
+
+	// only the flags of Go compiler are checked, the runtime is always optimized
+	for _, c := range []struct {
+		cu        CompileUnit
+		optimized bool
+	}{
+		{CompileUnit{name: "main", producer: "Go cmd/compile go1.27.1; -N -l regabi"}, false},
+		{CompileUnit{name: "main", producer: "Go cmd/compile go1.27.1; -N -l regabi", inlined: true}, true},
+		{CompileUnit{name: "main", producer: "Go cmd/compile go1.27.1; -N regabi -lx"}, true},
+		{CompileUnit{name: "main", producer: "Go cmd/compile go1.27.1; regabi"}, true},
+		{CompileUnit{name: "runtime", producer: "Go cmd/compile go1.27.1; -l regabi", inlined: true}, false},
+		{CompileUnit{name: "_cgo_export.c", producer: "GNU C17 12.2.0 -mtune=generic -O2"}, false},
+	} {
+		g.Expect(c.cu.optimized()).Should(Equal(c.optimized), c.cu.producer)
+	}
+
+	positional, launch, err := parseLaunchArgs([]string{"./main", "--", "-v", "a"})
+	g.Expect(err).Should(BeNil())
+	g.Expect(positional).Should(Equal([]string{"./main"}))
+	g.Expect(launch.args).Should(Equal([]string{"-v", "a"}))
+
+	clear_variable()
+}
+
+func TestLaunchConfigRestart(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		output   []byte
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	inputfile := path.Join(os.TempDir(), "__godbg_t8_stdin__")
+	outputfile := path.Join(os.TempDir(), "__godbg_t8_stdout__")
+	g.Expect(ioutil.WriteFile(inputfile, []byte("hello stdin\n"), 0644)).Should(BeNil())
+	defer os.Remove(inputfile)
+	defer os.Remove(outputfile)
+
+	_, target.launch, err = parseLaunchArgs([]string{"./test_file/t8.go",
+		"--env", "GODBG_ENV=hello", "--wd", os.TempDir(),
+		"--redirect", "stdin=" + inputfile, "--redirect", "stdout=" + outputfile,
+		"--", "a", "b"})
+	g.Expect(err).Should(BeNil())
+
+	execfile, err = build_run_debug("./test_file/t8.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+	errw.Reset()
+	output, err = ioutil.ReadFile(outputfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(string(output)).Should(Equal(fmt.Sprintf("args=[a b] env=hello wd=%s stdin=hello stdin\n", os.TempDir())))
+
+	executor("r -- c")
+	g.Expect(outw.String()).Should(ContainSubstring("restart new process pid"))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+	output, err = ioutil.ReadFile(outputfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(string(output)).Should(Equal(fmt.Sprintf("args=[c] env=hello wd=%s stdin=hello stdin\n", os.TempDir())))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestDebugPackage(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t9")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := target.cmd.Process.Pid
+
+	executor("b ./test_file/t9/util.go:4")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t9/util.go:4 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      4: 	c := a + b"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestDebugTestBinary(t *testing.T) {
+	var (
+		dir      string
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	dir, err = os.Getwd()
+	g.Expect(err).Should(BeNil())
+	execfile, err = buildTest(path.Join(dir, "./test_file/t9"), nil)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	target.execFile = execfile
+	target.bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	target.launch.args = []string{"-test.run", "TestAdd"}
+	target.cmd, err = runexec(execfile, target.launch)
+	g.Expect(err).Should(BeNil())
+	g.Expect(target.initThreads([]int{target.cmd.Process.Pid})).Should(BeNil())
+	g.Expect(os.Setenv("GODBG_TEST", "true")).Should(BeNil())
+	pid := target.cmd.Process.Pid
+
+	executor("b ./test_file/t9/util_test.go:7")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t9/util_test.go:7 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 	if c != 7 {"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestBuildFlagsAndCache(t *testing.T) {
+	var (
+		dir       string
+		execfile  string
+		execfile2 string
+		bi        *BI
+		err       error
+		g         = NewGomegaWithT(t)
+	)
+	dir, err = os.Getwd()
+	g.Expect(err).Should(BeNil())
+
+	g.Expect(splitQuotedFields(`-tags godbgtag -ldflags "-X main.a=b c"`)).Should(
+		Equal([]string{"-tags", "godbgtag", "-ldflags", "-X main.a=b c"}))
+
+	// build tags
+	execfile, err = build(path.Join(dir, "./test_file/t10"), []string{"-tags", "godbgtag"})
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	bi, err = analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(bi.Sources).Should(HaveKey(path.Join(dir, "./test_file/t10/tag_on.go")))
+	g.Expect(bi.Sources).ShouldNot(HaveKey(path.Join(dir, "./test_file/t10/tag_off.go")))
+
+	// the second build with the same sources is cached
+	execfile2, err = build(path.Join(dir, "./test_file/t10"), []string{"-tags", "godbgtag"})
+	g.Expect(err).Should(BeNil())
+	g.Expect(execfile2).Should(Equal(execfile))
+
+	// the changed sources are built again
+	filename := path.Join(os.TempDir(), "godbg_cache_t1.go")
+	content, err := ioutil.ReadFile(path.Join(dir, "./test_file/t1.go"))
+	g.Expect(err).Should(BeNil())
+	g.Expect(ioutil.WriteFile(filename, content, 0644)).Should(BeNil())
+	defer os.Remove(filename)
+	execfile, err = build(filename, nil)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	g.Expect(ioutil.WriteFile(filename, append(content, []byte("\nvar changed = 1\n")...), 0644)).Should(BeNil())
+	execfile2, err = build(filename, nil)
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile2)
+	g.Expect(execfile2).ShouldNot(Equal(execfile))
+
+	// the stderr of `go build` is in the error
+	g.Expect(ioutil.WriteFile(filename, []byte("package main\n\nfunc main() {\n\tundefinedFunc()\n}\n"), 0644)).Should(BeNil())
+	_, err = build(filename, nil)
+	g.Expect(err).ShouldNot(BeNil())
+	g.Expect(err.Error()).Should(ContainSubstring("undefined: undefinedFunc"))
+}
+
+func TestThreads(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t11.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := target.cmd.Process.Pid
+
+	executor("b ./test_file/t11.go:9")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t11.go:9 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      9: 	return n * 2"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	trapTid := target.curTid()
+
+	// the goroutines are locked to their own threads, so more than one thread is traced
+	executor("threads")
+	g.Expect(outw.String()).Should(MatchRegexp(`\* Thread %d at 0x[0-9a-f]+ .*t11.go:9 main.work`, trapTid))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	otherTid := 0
+	for _, thread := range target.sortedThreads() {
+		if thread.tid != trapTid {
+			otherTid = thread.tid
+		}
+	}
+	g.Expect(otherTid).ShouldNot(Equal(0))
+
+	executor(fmt.Sprintf("thread %d", otherTid))
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf("switch to thread %d", otherTid)))
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(target.curTid()).Should(Equal(otherTid))
+	outw.Reset()
+
+	executor("threads")
+	g.Expect(outw.String()).Should(MatchRegexp(`\* Thread %d at`, otherTid))
+	g.Expect(outw.String()).Should(MatchRegexp(`  Thread %d at 0x[0-9a-f]+ .*t11.go:9 main.work`, trapTid))
+	outw.Reset()
+
+	executor("thread 0")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find thread 0"))
+	errw.Reset()
+
+	// every goroutine traps on the breakpoint once, the thread switched away traps again
+	for i := 0; i < 10 && !strings.Contains(errw.String(), "has exited"); i++ {
+		executor("c")
+	}
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestStepOverClone(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t11.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := target.cmd.Process.Pid
+
+	// trap on the syscall instruction of runtime.clone
+	fn := target.bi.findFunction("runtime.clone")
+	g.Expect(fn).ShouldNot(BeNil())
+	code, err := target.readMemory(fn.lowpc, int(fn.highpc-fn.lowpc))
+	g.Expect(err).Should(BeNil())
+	i := bytes.Index(code, []byte{0x0f, 0x05})
+	g.Expect(i).Should(BeNumerically(">=", 0))
+	addr := fn.lowpc + uint64(i)
+	executor(fmt.Sprintf("b *0x%x", addr))
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("bc all")
+	tid := target.curTid()
+
+	// the step isn't finished by the clone event, it returns the new thread after the syscall
+	exited, err := target.stepThread(tid)
+	g.Expect(err).Should(BeNil())
+	g.Expect(exited).Should(BeFalse())
+	regs, err := getThreadDwarfRegisters(tid)
+	g.Expect(err).Should(BeNil())
+	g.Expect(regs.gp[dwarfRegRip]).Should(Equal(addr + 2))
+	g.Expect(target.threads).Should(HaveKey(int(regs.gp[0])))
+	g.Expect(target.threads[int(regs.gp[0])].running).Should(BeFalse())
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestGoroutines(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t12.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := target.cmd.Process.Pid
+
+	executor("b ./test_file/t12.go:7")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t12.go:7 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      7: 	done <- 1"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the goroutine trapped is running on the current thread, main goroutine is parked by `<-done`
+	executor("goroutines")
+	g.Expect(outw.String()).Should(MatchRegexp(`\* Goroutine \d+ running at 0x[0-9a-f]+ .*t12.go:7 main.work`))
+	g.Expect(outw.String()).Should(MatchRegexp(`  Goroutine 1 waiting at 0x[0-9a-f]+ .* runtime.gopark \[chan receive\]`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("goroutine 1")
+	g.Expect(outw.String()).Should(ContainSubstring("switch to goroutine 1"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// bt walks the stack of parked goroutine by its saved registers
+	executor("bt")
+	g.Expect(outw.String()).Should(MatchRegexp(`t12.go:13 main.main`))
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("main.work"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("goroutines")
+	g.Expect(outw.String()).Should(MatchRegexp(`\* Goroutine 1 waiting`))
+	outw.Reset()
+
+	executor("goroutine 10000")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find goroutine 10000"))
+	errw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestPrintAllKinds(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t13.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	pid := target.cmd.Process.Pid
+
+	executor("b ./test_file/t13.go:49")
+	g.Expect(outw.String()).Should(ContainSubstring("godbg add ./test_file/t13.go:49 breakpoint successfully"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for _, c := range []struct{ name, value string }{
+		{"i", "-42"},
+		{"u", "200"},
+		{"f", "3.5"},
+		{"c", "(1.5-2i)"},
+		{"b", "true"},
+		{"r", "71 'G'"},
+		{"s", `"hello"`},
+		{"p", `main.Point {X: 1, Y: 2, Name: "pt"}`},
+		{"pp", `*main.Point {X: 1, Y: 2, Name: "pt"}`},
+		{"arr", "[3]int [1,2,3]"},
+		{"sl", `[]string len: 2, cap: 2, ["a","b"]`},
+		{"m", `map[string]int len: 1, ["one": 1]`},
+		{"ch", "chan int len: 1, cap: 4, [7]"},
+		{"e", "interface {}(int) 10"},
+		{"sh", "main.Shape(main.Rect) {W: 2, H: 3}"},
+		{"fn", "fmt.Sprintf"},
+		{"n", "*main.Node {Val: 1, Next: *main.Node {...}}"},
+		{"np", "*main.Node nil"},
+		{"em", "map[string]int len: 0, []"},
+	} {
+		executor("p " + c.name)
+		g.Expect(outw.String()).Should(Equal(c.value+"\n"), c.name)
+		g.Expect(errw.String()).Should(Equal(""))
+		outw.Reset()
+	}
+
+	executor("p big")
+	g.Expect(outw.String()).Should(HavePrefix("[]int len: 200, cap: 200, [0,0,"))
+	g.Expect(outw.String()).Should(HaveSuffix(",0...+136 more]\n"))
+	outw.Reset()
+
+	// the limits of print are configurable
+	executor("config max-array-len 2")
+	g.Expect(outw.String()).Should(Equal("max-array-len 2\n"))
+	outw.Reset()
+	executor("config max-depth 1")
+	executor("config max-string-len 2")
+	outw.Reset()
+
+	executor("p big")
+	g.Expect(outw.String()).Should(Equal("[]int len: 200, cap: 200, [0,0...+198 more]\n"))
+	outw.Reset()
+	executor("p n")
+	g.Expect(outw.String()).Should(Equal("*main.Node {...}\n"))
+	outw.Reset()
+	executor("p s")
+	g.Expect(outw.String()).Should(Equal(`"he"...+3 more` + "\n"))
+	outw.Reset()
+
+	executor("config")
+	g.Expect(outw.String()).Should(Equal("max-depth 1\nmax-array-len 2\nmax-string-len 2\n"))
+	outw.Reset()
+
+	executor("p nothing")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find variable nothing"))
+	errw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(MatchRegexp("Process %d has exited with status 0", pid))
+
+	executor("q")
+	clear_variable()
+}
+
+func TestEvalExpression(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t13.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t13.go:49")
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for _, c := range []struct{ expr, value string }{
+		{"p.X", "1"},
+		{"pp.Name", `"pt"`},
+		{"(*pp).Y", "2"},
+		{"n.Next.Next.Val", "1"},
+		{"arr[2]", "3"},
+		{"sl[1]", `"b"`},
+		{"s[1]", "101"},
+		{`m["one"]`, "1"},
+		{"arr[1:]", "[]int len: 2, cap: 2, [2,3]"},
+		{"sl[:1]", `[]string len: 1, cap: 2, ["a"]`},
+		{"s[1:3]", `"el"`},
+		{"*pp", `main.Point {X: 1, Y: 2, Name: "pt"}`},
+		{"&p.Y", "*2"},
+		{"*&i", "-42"},
+		{"(*main.Point)(pp).X", "1"},
+		{"*(*Point)(pp)", `main.Point {X: 1, Y: 2, Name: "pt"}`},
+		{"len(sl)", "2"},
+		{"cap(ch)", "4"},
+		{"len(m)", "1"},
+		{"len(s) * 2", "10"},
+		{"i + 2", "-40"},
+		{"-i", "42"},
+		{"u + 100", "44"},
+		{"7 / 2", "3"},
+		{"f * 2", "7"},
+		{"i < 0 && b", "true"},
+		{`s == "hello"`, "true"},
+		{"np == nil", "true"},
+		{"pp != nil", "true"},
+		{"np != nil && np.Val > 0", "false"},
+		{"np == nil || np.Val > 0", "true"},
+		{"int(f)", "3"},
+		{"float64(i) / 8", "-5.25"},
+	} {
+		executor("p " + c.expr)
+		g.Expect(outw.String()).Should(Equal(c.value+"\n"), c.expr)
+		g.Expect(errw.String()).Should(Equal(""), c.expr)
+		outw.Reset()
+	}
+
+	for _, c := range []struct{ expr, err string }{
+		{"arr[3]", "index out of range [3] with length 3"},
+		{`m["two"]`, `can't find key "two" in map`},
+		{"*np", "nil pointer dereference"},
+		{"i + u", "mismatched types int and uint8"},
+		{"i / 0", "division by zero"},
+		{"p.Z", "can't find field Z"},
+	} {
+		executor("p " + c.expr)
+		g.Expect(errw.String()).Should(ContainSubstring(c.err), c.expr)
+		errw.Reset()
+		outw.Reset()
+	}
+
+	executor("c")
+}
+
+func TestLocalsArgsVars(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t14.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t14.go:13")
+	executor("b ./test_file/t14.go:16")
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the inner x shadows the outer one, y isn't declared yet
+	executor("locals")
+	g.Expect(outw.String()).Should(Equal("x = \"inner\"\n"))
+	outw.Reset()
+	executor("p x")
+	g.Expect(outw.String()).Should(Equal("\"inner\"\n"))
+	outw.Reset()
+	executor("p y")
+	g.Expect(errw.String()).Should(ContainSubstring("can't find variable y"))
+	errw.Reset()
+
+	// a and b are passed by registers, they are described by location lists
+	executor("args")
+	g.Expect(outw.String()).Should(Equal("a = 1\nb = 2\ntotal = 3\n"))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("locals")
+	g.Expect(outw.String()).Should(Equal("x = 1\ny = 2\n"))
+	outw.Reset()
+
+	executor("vars ^main\\.")
+	g.Expect(outw.String()).Should(Equal("main.counter = 4\nmain.greeting = \"hi\"\n"))
+	outw.Reset()
+	executor("p counter + 1")
+	g.Expect(outw.String()).Should(Equal("5\n"))
+	outw.Reset()
+
+	executor("vars (")
+	g.Expect(errw.String()).Should(ContainSubstring("missing closing )"))
+	errw.Reset()
+
+	executor("c")
+}
+
+func TestDwarfLocationExpression(t *testing.T) {
+	g := NewGomegaWithT(t)
+	clear_variable()
+
+	regs := &dwarfRegisters{cfa: 0x1010, frameBase: 0x1000, fsBase: 0x7000, tlsSize: 0x10}
+	regs.gp[dwarfRegRbp], regs.gp[dwarfRegRsp] = 0x2000, 0x1f00
+	memory := map[uint64]uint64{0x3000: 0x4000}
+	readMemory := func(addr uint64, size int) ([]byte, error) {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, memory[addr])
+		return buf[:size], nil
+	}
+
+	for _, c := range []struct {
+		name string
+		expr []byte
+		loc  *dwarfLocation
+	}{
+		{"fbreg", []byte{DW_OP_fbreg, 0x78}, &dwarfLocation{kind: locMemory, addr: 0xff8}},
+		{"cfa", []byte{DW_OP_call_frame_cfa}, &dwarfLocation{kind: locMemory, addr: 0x1010}},
+		{"breg", []byte{DW_OP_breg0 + dwarfRegRsp, 0x10}, &dwarfLocation{kind: locMemory, addr: 0x1f10}},
+		{"bregx", []byte{DW_OP_bregx, dwarfRegRbp, 0x70}, &dwarfLocation{kind: locMemory, addr: 0x1ff0}},
+		{"reg", []byte{DW_OP_reg0 + 3}, &dwarfLocation{kind: locRegister, regnum: 3}},
+		{"regx", []byte{DW_OP_regx, dwarfRegXmm0}, &dwarfLocation{kind: locRegister, regnum: dwarfRegXmm0}},
+		{"deref", []byte{DW_OP_addr, 0x00, 0x30, 0, 0, 0, 0, 0, 0, DW_OP_deref}, &dwarfLocation{kind: locMemory, addr: 0x4000}},
+		{"arithmetic", []byte{DW_OP_lit0 + 5, DW_OP_lit0 + 3, DW_OP_minus, DW_OP_lit0 + 2, DW_OP_mul, DW_OP_plus_uconst, 0x10}, &dwarfLocation{kind: locMemory, addr: 0x14}},
+		{"signed", []byte{DW_OP_const2s, 0xfe, 0xff, DW_OP_lit0 + 5, DW_OP_plus, DW_OP_consts, 0x7f, DW_OP_mul, DW_OP_abs}, &dwarfLocation{kind: locMemory, addr: 3}},
+		{"compare", []byte{DW_OP_lit0 + 3, DW_OP_lit0 + 5, DW_OP_lt, DW_OP_lit0 + 3, DW_OP_lit0 + 5, DW_OP_gt, DW_OP_swap, DW_OP_or}, &dwarfLocation{kind: locMemory, addr: 1}},
+		{"branch", []byte{DW_OP_lit0 + 2, DW_OP_lit0 + 1, DW_OP_bra, 0x01, 0x00, DW_OP_lit0 + 7, DW_OP_lit0 + 9, DW_OP_plus}, &dwarfLocation{kind: locMemory, addr: 11}},
+		{"no branch", []byte{DW_OP_lit0 + 2, DW_OP_lit0, DW_OP_bra, 0x01, 0x00, DW_OP_lit0 + 7, DW_OP_lit0 + 9, DW_OP_plus, DW_OP_plus}, &dwarfLocation{kind: locMemory, addr: 18}},
+		{"tls", []byte{DW_OP_const1u, 8, DW_OP_form_tls_address}, &dwarfLocation{kind: locMemory, addr: 0x6ff8}},
+		{"gnu tls", []byte{DW_OP_const1u, 0, DW_OP_GNU_push_tls_address}, &dwarfLocation{kind: locMemory, addr: 0x6ff0}},
+		{"pieces", []byte{DW_OP_reg0, DW_OP_piece, 8, DW_OP_piece, 4, DW_OP_fbreg, 0x70, DW_OP_piece, 8}, &dwarfLocation{kind: locPieces, pieces: []*dwarfLocation{
+			{kind: locRegister, regnum: 0, size: 8},
+			{kind: locEmpty, size: 4},
+			{kind: locMemory, addr: 0xff0, size: 8},
+		}}},
+	} {
+		loc, err := evalLocation(c.expr, regs, readMemory)
+		g.Expect(err).Should(BeNil(), c.name)
+		g.Expect(loc).Should(Equal(c.loc), c.name)
+	}
+
+	_, err := evalLocation([]byte{DW_OP_call2, 0, 0}, regs, readMemory)
+	g.Expect(err).Should(MatchError("unsupported dwarf operation 0x98"))
+	_, err = evalLocation([]byte{DW_OP_lit0, DW_OP_form_tls_address}, &dwarfRegisters{}, readMemory)
+	g.Expect(err).Should(MatchError("the thread pointer is unavailable"))
+	_, err = evalLocation([]byte{DW_OP_plus}, regs, readMemory)
+	g.Expect(err).Should(MatchError("dwarf expression stack is empty"))
+}
+
+func TestLocationListOfOptimizedBinary(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	// the variables of optimized binary are in registers, they are described by location lists
+	execfile, err = build_run_debug_flags("./test_file/t15.go", []string{"-gcflags", "all="})
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t15.go:11")
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// r isn't assigned yet, and the result has no location
+	executor("args")
+	g.Expect(outw.String()).Should(Equal("p = main.Point {X: 1, Y: 2}\nk = 3\n~r0 = (optimized out)\n"))
+	outw.Reset()
+	executor("locals")
+	g.Expect(outw.String()).Should(Equal("r = (optimized out)\n"))
+	outw.Reset()
+	executor("p r")
+	g.Expect(errw.String()).Should(ContainSubstring("optimized out"))
+	errw.Reset()
+
+	executor("b ./test_file/t15.go:12")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p r + k")
+	g.Expect(outw.String()).Should(Equal("12\n"))
+	outw.Reset()
+
+	executor("c")
+}
+
+func TestSetVariableAndWriteMemory(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t13.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t13.go:49")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for _, c := range []struct{ expr, value string }{
+		{"set i = 5", "i = 5"},
+		{"set i = i * -2", "i = -10"},
+		{"set u = 255", "u = 255"},
+		{"set f = 1.25", "f = 1.25"},
+		{"set c = 2i", "c = (0+2i)"},
+		{"set b = !b", "b = false"},
+		{"set r = 'x'", "r = 120 'x'"},
+		{"set p.X = 10", "p.X = 10"},
+		{"set arr[1] = arr[2]", "arr[1] = 3"},
+		{"set s = p.Name", `s = "pt"`},
+		{"set sl[0] = s", `sl[0] = "pt"`},
+		{"set n.Next = np", "n.Next = *main.Node nil"},
+		{"set pp = nil", "pp = *main.Point nil"},
+		{"set pp = &p", `pp = *main.Point {X: 10, Y: 2, Name: "pt"}`},
+	} {
+		executor(c.expr)
+		g.Expect(outw.String()).Should(Equal(c.value+"\n"), c.expr)
+		g.Expect(errw.String()).Should(Equal(""), c.expr)
+		outw.Reset()
+	}
+	executor("p sl")
+	g.Expect(outw.String()).Should(Equal(`[]string len: 2, cap: 2, ["pt","b"]` + "\n"))
+	outw.Reset()
+
+	for _, c := range []struct{ expr, err string }{
+		{"set u = 256", "constant 256 overflows uint8"},
+		{"set i = 1.5", "constant 1.5 truncated to int"},
+		{"set i = u", "can't assign uint8 to i of type int"},
+		{`set i = "x"`, `can't convert "x" to int`},
+		{"set s = 1", "can't assign 1 to s of type string"},
+		{"set i + 1 = 2", "can't assign to  which isn't in memory"},
+		{"set i", "the assignment should be `<expr> = <value>`"},
+	} {
+		executor(c.expr)
+		g.Expect(errw.String()).Should(ContainSubstring(c.err), c.expr)
+		errw.Reset()
+		outw.Reset()
+	}
+
+	// set register of current thread
+	executor("set reg rbx 0x1234")
+	g.Expect(outw.String()).Should(Equal("rbx = 0x1234\n"))
+	outw.Reset()
+	regs, err := getRegisters(target.cmd)
+	g.Expect(err).Should(BeNil())
+	g.Expect(regs.Rbx).Should(Equal(uint64(0x1234)))
+	executor("set reg xyz 1")
+	g.Expect(errw.String()).Should(ContainSubstring("unknown register xyz"))
+	errw.Reset()
+
+	// write raw bytes, the breakpoint at the address is kept
+	scope, err := newEvalScope(target.bi)
+	g.Expect(err).Should(BeNil())
+	arr, err := scope.evalString("arr")
+	g.Expect(err).Should(BeNil())
+	executor(fmt.Sprintf("write 0x%x 09 00 00 00 00 00 00 00", arr.addr))
+	g.Expect(outw.String()).Should(Equal(fmt.Sprintf("write 8 bytes at 0x%x\n", arr.addr)))
+	outw.Reset()
+	executor("p arr")
+	g.Expect(outw.String()).Should(Equal("[3]int [9,3,3]\n"))
+	outw.Reset()
+
+	info := target.bp.infos[0]
+	original := info.original[0]
+	executor(fmt.Sprintf("write 0x%x %02x", info.pc, original))
+	g.Expect(errw.String()).Should(Equal(""))
+	buf, err := target.readMemory(info.pc, 1)
+	g.Expect(err).Should(BeNil())
+	g.Expect(buf).Should(Equal([]byte{0xCC}))
+	g.Expect(info.original).Should(Equal([]byte{original}))
+	outw.Reset()
+
+	executor("c")
+}
+
+func TestCallFunction(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t16.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t16.go:47")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	for _, c := range []struct{ expr, value string }{
+		{"call add(1, 2)", "3"},
+		{"call main.add(n, len(s)+10)", "12"},
+		{"call half(3)", "1.5"},
+		{"call swap(7, \"seven\")", "\"seven\"\n7"},
+		{"call norm(p)", "5"},
+		{"call p.String()", "\"(3,4)\""},
+		{"call double(21)", "42"},
+		{"call p.Scale(2)", ""},
+	} {
+		executor(c.expr)
+		g.Expect(errw.String()).Should(Equal(""), c.expr)
+		if c.value != "" {
+			c.value += "\n"
+		}
+		g.Expect(outw.String()).Should(Equal(c.value), c.expr)
+		outw.Reset()
+	}
+	// the call changes the process, and the registers are restored after call
+	executor("p p")
+	g.Expect(outw.String()).Should(Equal("main.Point {X: 6, Y: 8}\n"))
+	outw.Reset()
+
+	for _, c := range []struct{ expr, err string }{
+		{`call boom("oops")`, `panic: interface {}(string) "oops"`},
+		{"call add(1)", "main.add needs 2 arguments, but 1 are given"},
+		{`call add(1, "x")`, `can't convert "x" to int`},
+		{"call n(1)", "n isn't a function"},
+		{"call nothing()", "can't find"},
+	} {
+		executor(c.expr)
+		g.Expect(errw.String()).Should(ContainSubstring(c.err), c.expr)
+		errw.Reset()
+		outw.Reset()
+	}
+
+	// the stack may be copied while the function grows it, sp is in the stack of goroutine after the call
+	curStack := func() *Goroutine {
+		gs, err := target.goroutines()
+		g.Expect(err).Should(BeNil())
+		for _, gr := range gs {
+			if gr.thread == target.curThread {
+				return gr
+			}
+		}
+		return nil
+	}
+	executor("call deep(200)")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("200\n"))
+	outw.Reset()
+	after := curStack()
+	regs, err := getContextRegisters()
+	g.Expect(err).Should(BeNil())
+	g.Expect(regs.Rsp >= after.stackLo && regs.Rsp < after.stackHi).Should(BeTrue())
+	executor("p p")
+	g.Expect(outw.String()).Should(Equal("main.Point {X: 6, Y: 8}\n"))
+	outw.Reset()
+	executor("bt")
+	g.Expect(outw.String()).Should(ContainSubstring("main.main()"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the process goes on after the calls
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+}
+
+func TestBacktraceByCFI(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t17.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t17.go:10")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// step into the first instruction of leaf, rbp is still the frame of middle
+	leaf := target.bi.findFunction("main.leaf")
+	g.Expect(leaf).ShouldNot(BeNil())
+	for i := 0; i < 20; i++ {
+		executor("s")
+		pc, err := getPtracePc()
+		g.Expect(err).Should(BeNil())
+		if pc == leaf.lowpc {
+			break
+		}
+	}
+	pc, _ := getPtracePc()
+	g.Expect(pc).Should(Equal(leaf.lowpc))
+	outw.Reset()
+
+	expected := []string{
+		"test_file/t17.go:5 main.leaf(n = 4)\n",
+		"test_file/t17.go:10 main.middle(n = 3)\n",
+		"test_file/t17.go:14 main.worker(",
+		"test_file/t17.go:19 main.main.gowrap1()\n",
+		"runtime.goexit()\n",
+	}
+	executor("bt")
+	bt := outw.String()
+	g.Expect(errw.String()).Should(Equal(""))
+	for i, line := range expected {
+		g.Expect(bt).Should(ContainSubstring(line))
+		if i > 0 {
+			g.Expect(strings.Index(bt, line)).Should(BeNumerically(">", strings.Index(bt, expected[i-1])))
+		}
+	}
+	// the unwinding stops at runtime.goexit
+	g.Expect(strings.HasSuffix(bt, "runtime.goexit()\n")).Should(BeTrue())
+	outw.Reset()
+
+	// the main goroutine is parked in chanrecv, its stack ends at runtime.main and runtime.goexit
+	executor("goroutine 1")
+	outw.Reset()
+	executor("bt")
+	g.Expect(outw.String()).Should(ContainSubstring("test_file/t17.go:20 main.main()\n"))
+	g.Expect(outw.String()).Should(MatchRegexp(`runtime.main\(\)\n.*runtime.goexit\(\)\n$`))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("q")
+}
+
+func TestFrameSelection(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t17.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t17.go:6")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("p n")
+	g.Expect(outw.String()).Should(Equal("4\n"))
+	outw.Reset()
+
+	executor("up")
+	g.Expect(outw.String()).Should(HavePrefix("frame 1 main.middle\n"))
+	g.Expect(outw.String()).Should(ContainSubstring("==>     10: \treturn leaf(n+1) + 1"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// print evaluates in the selected frame
+	executor("p n")
+	g.Expect(outw.String()).Should(Equal("3\n"))
+	outw.Reset()
+
+	executor("up")
+	g.Expect(outw.String()).Should(HavePrefix("frame 2 main.worker\n"))
+	outw.Reset()
+	executor("args")
+	g.Expect(outw.String()).Should(HavePrefix("ch = chan int"))
+	outw.Reset()
+
+	executor("bt")
+	g.Expect(outw.String()).Should(MatchRegexp(`\n  1  0x[0-9a-f]{16} /root/module/test_file/t17.go:10 main.middle\(n = 3\)\n`))
+	g.Expect(outw.String()).Should(MatchRegexp(`\n\* 2  0x[0-9a-f]{16} /root/module/test_file/t17.go:14 main.worker\(ch = chan int`))
+	outw.Reset()
+
+	// disass marks the call instruction of the selected frame
+	executor("disass")
+	g.Expect(outw.String()).Should(MatchRegexp(`===> t17.go:14 .*CALL`))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("down")
+	g.Expect(outw.String()).Should(HavePrefix("frame 1 main.middle\n"))
+	outw.Reset()
+	executor("frame 0")
+	g.Expect(outw.String()).Should(HavePrefix("frame 0 main.leaf\n"))
+	outw.Reset()
+
+	executor("down")
+	g.Expect(errw.String()).Should(Equal("the innermost frame has been selected\n"))
+	errw.Reset()
+	executor("up 100")
+	g.Expect(errw.String()).Should(Equal("the outermost frame has been selected\n"))
+	errw.Reset()
+	outw.Reset()
+
+	// the selected frame is reset after the process goes on
+	executor("frame 2")
+	executor("n")
+	outw.Reset()
+	executor("bt")
+	g.Expect(outw.String()).Should(HavePrefix("* "))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("q")
+}
+
+func TestRichBacktrace(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t17.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t17.go:6")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	leaf := target.bi.findFunction("main.leaf")
+	g.Expect(leaf).ShouldNot(BeNil())
+	executor("bt")
+	lines := strings.Split(strings.TrimSuffix(outw.String(), "\n"), "\n")
+	g.Expect(lines).Should(HaveLen(5))
+	g.Expect(lines[0]).Should(MatchRegexp(`^\* 0  0x0000000000[0-9a-f]{6} /root/module/test_file/t17.go:6 main.leaf\(n = 4\)$`))
+	g.Expect(lines[1]).Should(MatchRegexp(`^  1  0x[0-9a-f]{16} /root/module/test_file/t17.go:10 main.middle\(n = 3\)$`))
+	g.Expect(lines[4]).Should(HaveSuffix(" runtime.goexit()"))
+	var pc uint64
+	_, err = fmt.Sscanf(lines[0][5:], "0x%x", &pc)
+	g.Expect(err).Should(BeNil())
+	g.Expect(pc >= leaf.lowpc && pc < leaf.highpc).Should(BeTrue())
+	outw.Reset()
+
+	// limit the depth
+	executor("bt 2")
+	g.Expect(strings.Count(outw.String(), "\n")).Should(Equal(2))
+	g.Expect(outw.String()).Should(ContainSubstring("main.middle(n = 3)"))
+	outw.Reset()
+
+	// bt marks the selected frame
+	executor("up")
+	executor("up")
+	outw.Reset()
+	executor("bt 3")
+	g.Expect(outw.String()).Should(ContainSubstring("\n* 2  "))
+	outw.Reset()
+
+	// -all dumps every goroutine
+	executor("bt -all")
+	all := outw.String()
+	g.Expect(all).Should(MatchRegexp(`(?m)^goroutine 1 \[chan receive\]:\n(  .*\n)*  3  0x[0-9a-f]{16} /root/module/test_file/t17.go:20 main.main\(\)\n`))
+	g.Expect(all).Should(MatchRegexp(`(?m)^goroutine \d+ \[running\]:\n  0  0x[0-9a-f]{16} /root/module/test_file/t17.go:6 main.leaf\(n = 4\)\n  1 .*\n\* 2 `))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("bt 0")
+	g.Expect(errw.String()).Should(Equal("unsupport cmd `bt 0`\n"))
+	errw.Reset()
+
+	// -full prints the locals under the frames
+	executor("goroutine 1")
+	outw.Reset()
+	executor("bt -full")
+	g.Expect(outw.String()).Should(MatchRegexp(`/root/module/test_file/t17.go:20 main.main\(\)\n        ch = chan int len: 0, cap: 0\n`))
+	g.Expect(errw.String()).Should(Equal(""))
+
+	executor("q")
+}
+
+func TestCFAInstructions(t *testing.T) {
+	g := NewGomegaWithT(t)
+	clear_variable()
+
+	cie := &CommonInformationEntry{
+		code_alignment_factor:   1,
+		data_alignment_factor:   -8,
+		return_address_register: dwarfRegRip,
+		initial_instructions:    []byte{DW_CFA_def_cfa, dwarfRegRsp, 8, DW_CFA_offset | dwarfRegRip, 1},
+	}
+	fde := &FrameDescriptionEntry{CIE: cie, begin: 0x1000, size: 0x100, instructions: []byte{
+		DW_CFA_advance_loc | 1,
+		DW_CFA_def_cfa_offset, 16,
+		DW_CFA_offset | dwarfRegRbp, 2,
+		DW_CFA_advance_loc1, 3,
+		DW_CFA_def_cfa_register, dwarfRegRbp,
+		DW_CFA_remember_state,
+		DW_CFA_register, 3, 12,
+		DW_CFA_same_value, 12,
+		DW_CFA_undefined, 13,
+		DW_CFA_val_offset, 14, 1,
+		DW_CFA_val_offset_sf, 15, 0x7f,
+		DW_CFA_GNU_args_size, 8,
+		DW_CFA_advance_loc2, 0x10, 0,
+		DW_CFA_def_cfa_sf, dwarfRegRsp, 0x7e,
+		DW_CFA_restore | dwarfRegRbp,
+		DW_CFA_expression, 3, 2, DW_OP_lit0 + 16, DW_OP_minus,
+		DW_CFA_val_expression, 0, 2, DW_OP_breg0 + dwarfRegRbp, 8,
+		DW_CFA_advance_loc4, 0x10, 0, 0, 0,
+		DW_CFA_restore_state,
+		DW_CFA_set_loc, 0x30, 0x10, 0, 0, 0, 0, 0, 0,
+		DW_CFA_offset_extended_sf, 3, 0x7d,
+		DW_CFA_def_cfa_expression, 2, DW_OP_breg0 + dwarfRegRsp, 0x20,
+		DW_CFA_offset_extended, 12, 4,
+		DW_CFA_nop,
+	}}
+
+	ra := DWRule{rule: RuleOffset, offset: -8}
+	rbp := DWRule{rule: RuleOffset, offset: -16}
+	for _, c := range []struct {
+		pc    uint64
+		cfa   DWRule
+		rules map[uint64]DWRule
+	}{
+		{0x1000, DWRule{rule: RuleCFA, reg: dwarfRegRsp, offset: 8}, map[uint64]DWRule{dwarfRegRip: ra}},
+		{0x1003, DWRule{rule: RuleCFA, reg: dwarfRegRsp, offset: 16}, map[uint64]DWRule{dwarfRegRip: ra, dwarfRegRbp: rbp}},
+		{0x1004, DWRule{rule: RuleCFA, reg: dwarfRegRbp, offset: 16}, map[uint64]DWRule{
+			dwarfRegRip: ra, dwarfRegRbp: rbp,
+			3:  {rule: RuleRegister, reg: 12},
+			12: {rule: RuleSameVal},
+			13: {rule: RuleUndefined},
+			14: {rule: RuleValOffset, offset: -8},
+			15: {rule: RuleValOffset, offset: 8},
+		}},
+		{0x1014, DWRule{rule: RuleCFA, reg: dwarfRegRsp, offset: 16}, map[uint64]DWRule{
+			dwarfRegRip: ra,
+			0:           {rule: RuleValExpression, expression: []byte{DW_OP_breg0 + dwarfRegRbp, 8}},
+			3:           {rule: RuleExpression, expression: []byte{DW_OP_lit0 + 16, DW_OP_minus}},
+			12:          {rule: RuleSameVal},
+			13:          {rule: RuleUndefined},
+			14:          {rule: RuleValOffset, offset: -8},
+			15:          {rule: RuleValOffset, offset: 8},
+		}},
+		// restore_state goes back to remember_state
+		{0x1024, DWRule{rule: RuleCFA, reg: dwarfRegRbp, offset: 16}, map[uint64]DWRule{dwarfRegRip: ra, dwarfRegRbp: rbp}},
+		{0x10ff, DWRule{rule: RuleExpression, expression: []byte{DW_OP_breg0 + dwarfRegRsp, 0x20}}, map[uint64]DWRule{
+			dwarfRegRip: ra, dwarfRegRbp: rbp,
+			3:  {rule: RuleOffset, offset: 24},
+			12: {rule: RuleOffset, offset: -32},
+		}},
+	} {
+		frame, err := fde.frameAt(c.pc)
+		g.Expect(err).Should(BeNil())
+		g.Expect(*frame.cfa).Should(Equal(c.cfa), fmt.Sprintf("0x%x", c.pc))
+		g.Expect(frame.regsRule).Should(Equal(c.rules), fmt.Sprintf("0x%x", c.pc))
+	}
+
+	// unwind the registers by the rules
+	memory := map[uint64]uint64{0x7000: 0x1234, 0x7008: 0x401000, 0x7010: 0x7200, 0x7018: 0x402000, 0x7038: 0x5678}
+	readMemory := func(addr uint64, size int) ([]byte, error) {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, memory[addr])
+		return buf[:size], nil
+	}
+	regs := &dwarfRegisters{}
+	regs.gp[dwarfRegRsp], regs.gp[dwarfRegRbp], regs.gp[12] = 0x7000, 0x7100, 0x55
+
+	frame, err := fde.frameAt(0x1014)
+	g.Expect(err).Should(BeNil())
+	cfa, err := frame.computeCFA(regs, readMemory)
+	g.Expect(err).Should(BeNil())
+	g.Expect(cfa).Should(Equal(uint64(0x7010)))
+	caller, err := frame.unwind(regs, cfa, readMemory)
+	g.Expect(err).Should(BeNil())
+	for reg, value := range map[uint64]uint64{
+		dwarfRegRip: 0x401000, dwarfRegRsp: 0x7010, 0: 0x7108, 3: 0x1234,
+		12: 0x55, 14: 0x7008, 15: 0x7018,
+		// rbp isn't saved yet, it keeps the value of caller
+		dwarfRegRbp: 0x7100,
+	} {
+		g.Expect(caller.uint(reg)).Should(Equal(value), fmt.Sprintf("register %d", reg))
+	}
+	_, err = caller.uint(13)
+	g.Expect(err).Should(MatchError("register 13 is unavailable"))
+
+	frame, err = fde.frameAt(0x1030)
+	g.Expect(err).Should(BeNil())
+	cfa, err = frame.computeCFA(regs, readMemory)
+	g.Expect(err).Should(BeNil())
+	g.Expect(cfa).Should(Equal(uint64(0x7020)))
+	caller, err = frame.unwind(regs, cfa, readMemory)
+	g.Expect(err).Should(BeNil())
+	for reg, value := range map[uint64]uint64{dwarfRegRip: 0x402000, dwarfRegRsp: 0x7020, dwarfRegRbp: 0x7200, 3: 0x5678, 12: 0x1234} {
+		g.Expect(caller.uint(reg)).Should(Equal(value), fmt.Sprintf("register %d", reg))
+	}
+
+	// the operand of DW_CFA_set_loc is pc relative in .eh_frame, and the absolute one is moved by the load bias
+	pcrel := *cie
+	pcrel.fdeEncoding = DW_EH_PE_pcrel | DW_EH_PE_sdata4
+	setloc := []byte{DW_CFA_set_loc, 0, 0, 0, 0, DW_CFA_def_cfa_offset, 32}
+	rel := int32(0x1010 - 0x2001)
+	binary.LittleEndian.PutUint32(setloc[1:], uint32(rel))
+	fde = &FrameDescriptionEntry{CIE: &pcrel, begin: 0x1000, size: 0x100, instructions: setloc, instructionsAddr: 0x2000}
+	for pc, offset := range map[uint64]int64{0x100f: 8, 0x1010: 32} {
+		frame, err = fde.frameAt(pc)
+		g.Expect(err).Should(BeNil())
+		g.Expect(frame.cfa.offset).Should(Equal(offset), fmt.Sprintf("0x%x", pc))
+	}
+	fde = &FrameDescriptionEntry{CIE: cie, begin: 0x11000, size: 0x100, staticBase: 0x10000, instructions: []byte{
+		DW_CFA_set_loc, 0x10, 0x10, 0, 0, 0, 0, 0, 0,
+		DW_CFA_def_cfa_offset, 32,
+	}}
+	for pc, offset := range map[uint64]int64{0x1100f: 8, 0x11010: 32} {
+		frame, err = fde.frameAt(pc)
+		g.Expect(err).Should(BeNil())
+		g.Expect(frame.cfa.offset).Should(Equal(offset), fmt.Sprintf("0x%x", pc))
+	}
+
+	_, err = (&FrameDescriptionEntry{CIE: cie, begin: 0x1000, size: 0x10, instructions: []byte{DW_CFA_restore_state}}).frameAt(0x1000)
+	g.Expect(err).Should(MatchError("DW_CFA_restore_state without DW_CFA_remember_state"))
+}
+
+func TestEhFrame(t *testing.T) {
+	g := NewGomegaWithT(t)
+	clear_variable()
+
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	execfile, err := build(path.Join(dir, "./test_file/t18.go"), nil)
+	g.Expect(err).Should(BeNil())
+	bi, err := analyze(execfile)
+	g.Expect(err).Should(BeNil())
+	g.Expect(bi.ehFrame).ShouldNot(BeNil())
+
+	// the C function is only described by .eh_frame
+	elffile, err := elf.Open(execfile)
+	g.Expect(err).Should(BeNil())
+	defer elffile.Close()
+	symbols, err := elffile.Symbols()
+	g.Expect(err).Should(BeNil())
+	var cadd uint64
+	for _, symbol := range symbols {
+		if symbol.Name == "cadd" {
+			cadd = symbol.Value
+		}
+	}
+	g.Expect(cadd).ShouldNot(BeZero())
+	for _, info := range bi.FramesInformation {
+		if info.FDE != nil {
+			g.Expect(info.FDE.begin <= cadd && cadd < info.FDE.begin+info.FDE.size).Should(BeFalse())
+		}
+	}
+	frame, err := bi.findFrameInformation(cadd)
+	g.Expect(err).Should(BeNil())
+	g.Expect(frame.cie.augmentation).Should(HavePrefix("z"))
+	g.Expect(frame.cie.fdeEncoding & 0x70).Should(Equal(byte(DW_EH_PE_pcrel)))
+	g.Expect(*frame.cfa).Should(Equal(DWRule{rule: RuleCFA, reg: dwarfRegRsp, offset: 8}))
+	g.Expect(frame.regsRule[frame.cie.return_address_register]).Should(Equal(DWRule{rule: RuleOffset, offset: -8}))
+
+	// the search table of .eh_frame_hdr is the same as parsing all FDEs
+	section := elffile.Section(".eh_frame")
+	data, err := section.Data()
+	g.Expect(err).Should(BeNil())
+	eh, err := newEhFrame(data, section.Addr, nil, 0)
+	g.Expect(err).Should(BeNil())
+	g.Expect(eh.table).Should(Equal(bi.ehFrame.table))
+
+	// the go functions are still unwound by .debug_frame
+	_, err = build_run_debug("./test_file/t18.go")
+	g.Expect(err).Should(BeNil())
+	outw, _ := make_out_err()
+	executor("b ./test_file/t18.go:15")
+	executor("c")
+	executor("bt")
+	g.Expect(outw.String()).Should(ContainSubstring("main.main()"))
+	executor("q")
+}
+
+func TestPositionIndependentExecutable(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug_flags("./test_file/t17.go", []string{"-buildmode=pie"})
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	g.Expect(target.bi.pie).Should(BeTrue())
+	g.Expect(target.bi.staticBase).ShouldNot(BeZero())
+
+	executor("b ./test_file/t17.go:6")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring("==>      6: \treturn n * 2"))
+	outw.Reset()
+
+	executor("p n")
+	g.Expect(outw.String()).Should(Equal("4\n"))
+	outw.Reset()
+
+	executor("bt")
+	g.Expect(outw.String()).Should(ContainSubstring("main.middle(n = 3)"))
+	g.Expect(outw.String()).Should(ContainSubstring("main.worker("))
+	outw.Reset()
+
+	// the goroutines are found by the package variable runtime.allgs
+	executor("bt -all")
+	g.Expect(outw.String()).Should(ContainSubstring("main.main()"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	executor("disass")
+	g.Expect(outw.String()).Should(ContainSubstring("=>"))
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the breakpoint is moved with the static base of new process
+	executor("r")
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p n")
+	g.Expect(outw.String()).Should(Equal("4\n"))
+	executor("q")
+}
+
+func TestConditionalBreakPoint(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t19.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t19.go:11 if r.id ==")
+	g.Expect(errw.String()).Should(HavePrefix("invalid condition `r.id ==`"))
+	errw.Reset()
+
+	executor("b ./test_file/t19.go:11 if r.id == 1")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(HaveSuffix(", if r.id == 1\n"))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p r.id")
+	g.Expect(outw.String()).Should(Equal("1\n"))
+	outw.Reset()
+
+	// the process stops at the breakpoint when the condition can't be evaluated
+	executor("cond 1 r.id")
+	g.Expect(outw.String()).Should(Equal("breakpoint 1 stops if r.id\n"))
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("the condition isn't boolean"))
+	errw.Reset()
+	outw.Reset()
+	executor("p r.id")
+	g.Expect(outw.String()).Should(Equal("2\n"))
+	outw.Reset()
+
+	executor(`cond 1 r.path == "/r/4"`)
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p r.id")
+	g.Expect(outw.String()).Should(Equal("4\n"))
+	outw.Reset()
+
+	executor("cond 1")
+	g.Expect(outw.String()).Should(Equal("breakpoint 1 is unconditional\n"))
+	executor("cond 2 r.id == 1")
+	g.Expect(errw.String()).Should(Equal("can't find breakpoint 2\n"))
+	errw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+}
+
+func TestHitCountBreakPoint(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t19.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	// the temporary breakpoint is cleared after the first stop
+	executor("tbreak ./test_file/t19.go:17")
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p i")
+	g.Expect(outw.String()).Should(Equal("0\n"))
+	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(Equal("there is no breakpoint\n"))
+	outw.Reset()
+
+	executor("b ./test_file/t19.go:11 hits>>3")
+	g.Expect(errw.String()).Should(Equal("invalid hit condition `hits>>3`\n"))
+	errw.Reset()
+
+	executor("b ./test_file/t19.go:11 hits>=3")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p r.id")
+	g.Expect(outw.String()).Should(Equal("2\n"))
+	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(MatchRegexp(`^2 \. \./test_file/t19\.go:11, pc 0x[0-9a-f]+, hits 3, stop if hits>=3\n$`))
+	outw.Reset()
+
+	// the id 1 is used by the temporary breakpoint
+	executor("ignore 2 1")
+	g.Expect(outw.String()).Should(Equal("breakpoint 2 will ignore next 1 hits\n"))
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p r.id")
+	g.Expect(outw.String()).Should(Equal("4\n"))
+	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(ContainSubstring(", hits 5,"))
+
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+}
+
+func TestEnableDisableBreakPoint(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t19.go")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t19.go:11")
+	executor("b ./test_file/t19.go:17")
+	executor("b ./test_file/t19.go:19")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+
+	// the ids of the others are kept after clearing
+	executor("bc 2")
+	g.Expect(outw.String()).Should(Equal("clear breakpoint 2 successfully\n"))
+	outw.Reset()
+	executor("disable 1")
+	g.Expect(outw.String()).Should(Equal("breakpoint 1 is disabled\n"))
+	outw.Reset()
+	executor("bl")
+	g.Expect(outw.String()).Should(MatchRegexp(`^1 \. \./test_file/t19\.go:11, pc 0x[0-9a-f]+, disabled, hits 0\n` +
+		`3 \. \./test_file/t19\.go:19, pc 0x[0-9a-f]+, hits 0\n$`))
+	outw.Reset()
+	executor("enable 2")
+	g.Expect(errw.String()).Should(Equal("can't find breakpoint 2\n"))
+	errw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p sum")
+	g.Expect(outw.String()).Should(Equal("20\n"))
+	outw.Reset()
+
+	// the disabled breakpoint isn't written into the new process
+	executor("r")
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("c")
+	outw.Reset()
+	executor("p sum")
+	g.Expect(outw.String()).Should(Equal("20\n"))
+	outw.Reset()
+
+	executor("r")
+	executor("enable all")
+	g.Expect(outw.String()).Should(HaveSuffix("2 breakpoints are enabled\n"))
+	executor("c")
+	outw.Reset()
+	executor("p r.id")
+	g.Expect(outw.String()).Should(Equal("0\n"))
+	outw.Reset()
+
+	// the pc is moved back when the breakpoint which the process stops on is disabled
+	executor("disable 1")
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p sum")
+	g.Expect(outw.String()).Should(Equal("20\n"))
+
+	executor("disable all")
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+}
+
+func TestFunctionBreakPoint(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	execfile, err = build_run_debug("./test_file/t20")
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+	dir, err := os.Getwd()
+	g.Expect(err).Should(BeNil())
+	mainfile := path.Join(dir, "test_file/t20/main.go")
+
+	// the address breakpoint stops before the prologue
+	entry := target.bi.findFunction("main.main").lowpc
+	executor(fmt.Sprintf("b *0x%x", entry))
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>     21: func main() {"))
+	outw.Reset()
+
+	executor("b (*Server).ServeHTTP")
+	g.Expect(outw.String()).Should(Equal(fmt.Sprintf("godbg add %s:13 breakpoint successfully\n", mainfile)))
+	executor("b main.handler")
+	executor("b t20/server.Handle")
+	g.Expect(errw.String()).Should(Equal(""))
+	executor("b nosuch.Func")
+	g.Expect(errw.String()).Should(Equal("can't find function nosuch.Func\n"))
+	errw.Reset()
+	executor("b *0x10")
+	g.Expect(errw.String()).ShouldNot(Equal(""))
+	errw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	outw.Reset()
+	executor("p path")
+	g.Expect(outw.String()).Should(Equal("\"/a\"\n"))
+	outw.Reset()
+
+	// the line is in the file of current frame
+	executor("b :25")
+	g.Expect(outw.String()).Should(Equal(fmt.Sprintf("godbg add %s:25 breakpoint successfully\n", mainfile)))
+	outw.Reset()
+
+	executor("c")
+	outw.Reset()
+	executor("p n")
+	g.Expect(outw.String()).Should(Equal("1\n"))
+	outw.Reset()
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>     25: \tfmt.Println(server.Handle(2))"))
+	outw.Reset()
+	executor("c")
+	outw.Reset()
+	executor("p n")
+	g.Expect(outw.String()).Should(Equal("2\n"))
+	outw.Reset()
+
+	// the function breakpoint stops at the line of declaration after the prologue
+	executor("b +2")
+	g.Expect(outw.String()).Should(MatchRegexp(`server\.go:5 breakpoint successfully\n$`))
+	executor("c")
+	g.Expect(outw.String()).Should(ContainSubstring("==>      5: \treturn n"))
+	outw.Reset()
+
+	executor("rbreak ^main\\.")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(ContainSubstring(fmt.Sprintf(". main.main %s:21\n", mainfile)))
+	g.Expect(outw.String()).ShouldNot(ContainSubstring("main.handler"))
+	g.Expect(outw.String()).Should(HaveSuffix("godbg add 1 breakpoints successfully\n"))
+
+	executor("c")
+	g.Expect(errw.String()).Should(ContainSubstring("has exited with status 0"))
+}
+
+func TestInlinedBreakPoint(t *testing.T) {
+	var (
+		execfile string
+		err      error
+		g        = NewGomegaWithT(t)
+	)
+	clear_variable()
+	outw, errw := make_out_err()
+
+	// leaf and middle are inlined in top
+	execfile, err = build_run_debug_flags("./test_file/t21", []string{"-gcflags=test_file/t21=-N"})
+	g.Expect(err).Should(BeNil())
+	defer os.Remove(execfile)
+
+	executor("b ./test_file/t21/main.go:6")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(Equal("godbg add ./test_file/t21/main.go:6 breakpoint at 2 locations successfully\n"))
+	outw.Reset()
+
+	executor("bl")
+	g.Expect(outw.String()).Should(HavePrefix("1 . ./test_file/t21/main.go:6, 2 locations, hits 0\n"))
+	g.Expect(outw.String()).Should(MatchRegexp(`(?m)^    1\.1 pc 0x[0-9a-f]+ in main\.leaf inlined in main\.middle inlined in main\.top$`))
+	g.Expect(outw.String()).Should(MatchRegexp(`(?m)^    1\.2 pc 0x[0-9a-f]+ in main\.leaf inlined in main\.middle inlined in main\.top$`))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HavePrefix("breakpoint 1.1, main.leaf inlined in main.middle inlined in main.top\n"))
+	g.Expect(outw.String()).Should(ContainSubstring("==>      6: \tn *= 2"))
+	outw.Reset()
+
+	executor("c")
+	g.Expect(outw.String()).Should(HavePrefix("breakpoint 1.2, main.leaf inlined in main.middle inlined in main.top\n"))
+	outw.Reset()
+
+	executor("disable 1")
+	executor("b ./test_file/t21/main.go:24")
+	g.Expect(outw.String()).Should(HaveSuffix("godbg add ./test_file/t21/main.go:24 breakpoint successfully\n"))
+	outw.Reset()
+
+	// the breakpoint with one location isn't reported
+	executor("c")
+	g.Expect(errw.String()).Should(Equal(""))
+	g.Expect(outw.String()).Should(HavePrefix("current process pc = "))
+	g.Expect(outw.String()).Should(ContainSubstring("==>     24: \tfmt.Println(sum)"))
+	outw.Reset()
+
+	executor("bl")
+	g.Expect(outw.String()).Should(HavePrefix("1 . ./test_file/t21/main.go:6, 2 locations, disabled, hits 2\n"))
+	outw.Reset()
+
+	executor("q")
+}
+
+func TestCheckBuildTarget(t *testing.T) {
+	g := NewGomegaWithT(t)
+	clear_variable()
+
+	g.Expect(checkBuildTarget("./test_file/t1.go")).Should(BeNil())
+	g.Expect(checkBuildTarget("./test_file/t20")).Should(BeNil())
+	g.Expect(checkBuildTarget("github.com/debugger101/godbg/log")).Should(BeNil())
+	g.Expect(checkBuildTarget("./test_file/nosuch.go")).Should(MatchError("can't find the file ./test_file/nosuch.go"))
+	g.Expect(checkBuildTarget("./test_file/go.mod")).Should(MatchError("./test_file/go.mod isn't a .go file, a directory or a package"))
+	g.Expect(checkBuildTarget("github.com/debugger101/godbg/nosuch")).ShouldNot(BeNil())
+}
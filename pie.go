@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// loadStaticBase computes the load bias of position-independent executable by the entry point in auxiliary vector,
+// then the addresses of bi and breakpoints are relocated. The bias may change when the process is restarted.
+func (t *Target) loadStaticBase(pid int) error {
+	if !t.bi.pie {
+		return nil
+	}
+	auxv, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/auxv", pid))
+	if err != nil {
+		return err
+	}
+	entry := entryPointFromAuxvAMD64(auxv)
+	if entry == 0 {
+		return fmt.Errorf("can't find the entry point in auxv of process %d", pid)
+	}
+	delta := t.bi.relocate(entry - t.bi.entry)
+	for _, info := range t.bp.infos {
+		info.pc += delta
+	}
+	return nil
+}
+
+// relocate moves the addresses of bi to staticBase, it return the delta from the old static base.
+// The location lists stay in the static addresses, they are searched by the pc without static base.
+func (bi *BI) relocate(staticBase uint64) uint64 {
+	delta := staticBase - bi.staticBase
+	if delta == 0 {
+		return 0
+	}
+	bi.staticBase = staticBase
+	for _, lines := range bi.Sources {
+		for _, entries := range lines {
+			for _, entry := range entries {
+				entry.Address += delta
+			}
+		}
+	}
+	for _, f := range bi.Functions {
+		f.lowpc += delta
+		f.highpc += delta
+		for _, lv := range f.variables {
+			for i := range lv.ranges {
+				lv.ranges[i][0] += delta
+				lv.ranges[i][1] += delta
+			}
+		}
+		for _, call := range f.inlinedCalls {
+			for i := range call.ranges {
+				call.ranges[i][0] += delta
+				call.ranges[i][1] += delta
+			}
+		}
+	}
+	for _, info := range bi.FramesInformation {
+		if info.FDE != nil {
+			info.FDE.begin += delta
+			info.FDE.staticBase = staticBase
+		}
+	}
+	if bi.ehFrame != nil {
+		bi.ehFrame.relocate(delta)
+	}
+	bi.typesStart += delta
+	// the addresses after prologue are collected again from the relocated line table
+	bi.prologueEnds = nil
+	return delta
+}
+
+// relocate moves .eh_frame and its search table, the pc relative addresses of FDEs follow the section
+func (eh *ehFrame) relocate(delta uint64) {
+	eh.addr += delta
+	eh.staticBase += delta
+	for i := range eh.table {
+		eh.table[i].pc += delta
+	}
+}
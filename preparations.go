@@ -1,34 +1,175 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"go.uber.org/zap"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 )
 
-func checkArgs() error {
+// LaunchConfig is how the debugged programe is built and started, `restart` reuses it.
+type LaunchConfig struct {
+	args []string
+	env  []string
+	wd   string
+	// redirects are the files for stdin, stdout and stderr
+	redirects [3]string
+	// buildFlags are passed to `go build` after `-gcflags all=-N -l`
+	buildFlags []string
+}
+
+var redirectNames = []string{"stdin", "stdout", "stderr"}
+
+// parseLaunchArgs split args into positional arguments and the launch config, such as
+// `main.go --env KEY=VAL --wd <dir> --redirect stdin=<file> -- arg1 arg2`
+func parseLaunchArgs(args []string) ([]string, *LaunchConfig, error) {
+	positional := make([]string, 0, len(args))
+	launch := &LaunchConfig{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--":
+			launch.args = args[i+1:]
+			return positional, launch, nil
+		case "--env", "--wd", "--redirect", "--build-flags":
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+		default:
+			positional = append(positional, arg)
+			continue
+		}
+
+		value := args[i]
+		switch arg {
+		case "--env":
+			if !strings.Contains(value, "=") {
+				return nil, nil, fmt.Errorf("--env %s should be like KEY=VAL", value)
+			}
+			launch.env = append(launch.env, value)
+		case "--wd":
+			launch.wd = value
+		case "--build-flags":
+			launch.buildFlags = append(launch.buildFlags, splitQuotedFields(value)...)
+		case "--redirect":
+			sps := strings.SplitN(value, "=", 2)
+			found := false
+			for fd, name := range redirectNames {
+				if len(sps) == 2 && sps[0] == name && sps[1] != "" {
+					launch.redirects[fd] = sps[1]
+					found = true
+				}
+			}
+			if !found {
+				return nil, nil, fmt.Errorf("--redirect %s should be like stdin=<file>", value)
+			}
+		}
+	}
+	return positional, launch, nil
+}
+
+// splitQuotedFields splits s around spaces like the shell, the quoted string by ' or " is one field
+func splitQuotedFields(s string) []string {
+	var (
+		fields  []string
+		field   []rune
+		quote   rune
+		inField bool
+	)
+	for _, r := range s {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			field = append(field, r)
+		case r == '\'' || r == '"':
+			quote = r
+			inField = true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, string(field))
+				field = field[:0]
+				inField = false
+			}
+		default:
+			field = append(field, r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, string(field))
+	}
+	return fields
+}
+
+// checkArgs return the file or pid to debug and how to launch it
+func checkArgs() (string, *LaunchConfig, error) {
 	logger.Debug("[checkArgs]", zap.Strings("args", os.Args))
-	if len(os.Args) != 3 {
-		return errors.New("len(args) != 3")
+	if len(os.Args) < 3 {
+		return "", nil, errors.New("len(args) < 3")
 	}
-	debug := os.Args[1]
+	positional, launch, err := parseLaunchArgs(os.Args[2:])
+	if err != nil {
+		return "", nil, err
+	}
+	if len(positional) != 1 {
+		return "", nil, errors.New("please input only one file or pid")
+	}
+
+	switch os.Args[1] {
+	case "debug", "test":
+		if err = checkBuildTarget(positional[0]); err != nil {
+			return "", nil, err
+		}
+	case "attach":
+		if len(os.Args) != 3 {
+			return "", nil, errors.New("len(args) != 3")
+		}
+		if _, err := strconv.Atoi(positional[0]); err != nil {
+			return "", nil, errors.New("please input the pid of process")
+		}
+	case "exec":
+	default:
+		return "", nil, errors.New("only support `debug`, `test`, `exec` and `attach`")
+	}
+	return positional[0], launch, nil
+}
 
-	if debug != "debug" {
-		return errors.New("only support `debug`")
+// checkBuildTarget checks the argument of `debug` and `test` is a .go file, a directory or a package found by go list
+func checkBuildTarget(filename string) error {
+	if info, err := os.Stat(filename); err == nil {
+		if info.IsDir() || path.Ext(filename) == ".go" {
+			return nil
+		}
+		return fmt.Errorf("%s isn't a .go file, a directory or a package", filename)
+	}
+	if path.Ext(filename) == ".go" {
+		return fmt.Errorf("can't find the file %s", filename)
 	}
-	if path.Ext(os.Args[2]) != ".go" {
-		return errors.New("please input .go file")
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", "list", "--", filename)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s isn't a .go file, a directory or a package: %s", filename, strings.TrimSpace(stderr.String()))
 	}
 	return nil
 }
 
-func absoluteFilename() (string, error) {
-	filename := os.Args[2]
+func absoluteFilename(filename string) (string, error) {
 	if path.IsAbs(filename) {
 		return filename, nil
 	}
@@ -46,23 +187,243 @@ func absoluteFilename() (string, error) {
 	return filename, nil
 }
 
-func build(filename string) (string, error) {
+// build the .go file, the directory or the package into executable file.
+// The directory is built in itself, so the module which it belongs to is used.
+func build(filename string, buildFlags []string) (string, error) {
+	return gobuild(filename, false, buildFlags)
+}
+
+// buildTest compiles the test binary of the directory or the package by `go test -c`
+func buildTest(filename string, buildFlags []string) (string, error) {
+	return gobuild(filename, true, buildFlags)
+}
+
+func gobuild(filename string, test bool, buildFlags []string) (string, error) {
+	var (
+		dir    string
+		pkg    = filename
+		stderr bytes.Buffer
+	)
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		dir, pkg = filename, "."
+	}
+
 	base := filepath.Base(filename)
+	if test {
+		base += ".test"
+	}
+
+	// the output is cached by the hash of sources, so the same sources are built only once
 	execfile := path.Join(os.TempDir(), "__"+base+"__")
+	cachedir, hash, err := buildCacheKey(dir, pkg, test, buildFlags)
+	if err == nil {
+		execfile = path.Join(cachedir, hash+"-"+base)
+		if _, err = os.Stat(execfile); err == nil {
+			logger.Debug("gobuild:cached", zap.String("execfile", execfile))
+			now := time.Now()
+			_ = os.Chtimes(execfile, now, now)
+			return execfile, nil
+		}
+	} else {
+		logger.Error("gobuild:buildCacheKey", zap.Error(err), zap.String("filename", filename))
+	}
 
-	args := []string{"build", "-gcflags", "all=-N -l", "-o", execfile, filename}
+	args := []string{"build", "-gcflags", "all=-N -l"}
+	if test {
+		args = []string{"test", "-c", "-gcflags", "all=-N -l"}
+	}
+	args = append(args, buildFlags...)
+	args = append(args, "-o", execfile, pkg)
 
 	cmd := exec.Command("go", args...)
-	return execfile, cmd.Run()
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		logger.Error("gobuild", zap.Error(err), zap.Strings("args", args), zap.String("stderr", stderr.String()))
+		return "", fmt.Errorf("go %s: %s\n%s", strings.Join(args, " "), err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	if cachedir != "" {
+		if err := trimBuildCache(cachedir); err != nil {
+			logger.Error("gobuild:trimBuildCache", zap.Error(err), zap.String("cachedir", cachedir))
+		}
+	}
+	return execfile, nil
 }
 
-// not supoort arguments of cmds
-func runexec(execfile string) (*exec.Cmd, error) {
-	cmd := exec.Command(execfile)
+// the files of all packages which are not in standard library, one file per line
+const buildCacheListTemplate = `{{if not .Standard}}{{$dir := .Dir}}` +
+	`{{range .GoFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .CgoFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .CFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .HFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .SFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .EmbedFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .TestGoFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .TestEmbedFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .XTestGoFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{range .XTestEmbedFiles}}{{$dir}}{{"\t"}}{{.}}{{"\n"}}{{end}}` +
+	`{{with .Module}}{{if .GoMod}}{{.GoMod}}{{"\n"}}{{end}}{{end}}{{end}}`
+
+// buildCacheEnv is the environment which changes the output of go build
+var buildCacheEnv = []string{"GOOS", "GOARCH", "CGO_ENABLED", "GOFLAGS", "GOEXPERIMENT"}
+
+// buildCacheMaxSize is the total size of executable files in the cache, the least recently used ones are removed beyond it
+const buildCacheMaxSize = 1 << 30
+
+// buildCacheDir return the directory of cached executable files
+func buildCacheDir() (string, error) {
+	cachedir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(cachedir, "godbg"), nil
+}
+
+// inBuildCache reports whether the executable file is kept in the cache, the others are removed after debugging
+func inBuildCache(execfile string) bool {
+	cachedir, err := buildCacheDir()
+	return err == nil && filepath.Dir(execfile) == cachedir
+}
+
+// buildCacheKey return the cache directory and the hash of go version, build environment, build flags and all sources
+// which the package depends on, except the standard library. go.sum is hashed with go.mod.
+func buildCacheKey(dir string, pkg string, test bool, buildFlags []string) (string, string, error) {
+	var (
+		cachedir string
+		version  []byte
+		env      []byte
+		list     []byte
+		err      error
+	)
+	if cachedir, err = buildCacheDir(); err != nil {
+		return "", "", err
+	}
+	if err = os.MkdirAll(cachedir, 0755); err != nil {
+		return "", "", err
+	}
+
+	if version, err = exec.Command("go", "version").Output(); err != nil {
+		return "", "", err
+	}
+	envCmd := exec.Command("go", append([]string{"env"}, buildCacheEnv...)...)
+	envCmd.Dir = dir
+	if env, err = envCmd.Output(); err != nil {
+		return "", "", err
+	}
+
+	args := []string{"list", "-deps", "-f", buildCacheListTemplate}
+	if test {
+		args = append(args, "-test")
+	}
+	args = append(args, buildFlags...)
+	args = append(args, pkg)
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	if list, err = cmd.Output(); err != nil {
+		return "", "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%v\n%s\n%v\n", version, env, test, pkg, buildFlags)
+	existed := make(map[string]bool)
+	for _, line := range strings.Split(string(list), "\n") {
+		if line == "" {
+			continue
+		}
+		filename := line
+		if sps := strings.SplitN(line, "\t", 2); len(sps) == 2 {
+			filename = sps[1]
+			if !filepath.IsAbs(filename) {
+				filename = filepath.Join(sps[0], sps[1])
+			}
+		}
+		filenames := []string{filename}
+		if filepath.Base(filename) == "go.mod" {
+			filenames = append(filenames, filepath.Join(filepath.Dir(filename), "go.sum"))
+		}
+		for _, filename := range filenames {
+			if existed[filename] {
+				continue
+			}
+			existed[filename] = true
+
+			content, err := ioutil.ReadFile(filename)
+			if os.IsNotExist(err) && filepath.Base(filename) == "go.sum" {
+				continue
+			}
+			if err != nil {
+				return "", "", err
+			}
+			fmt.Fprintf(h, "%s %d\n", filename, len(content))
+			h.Write(content)
+		}
+	}
+	return cachedir, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// trimBuildCache removes the least recently used executable files until the cache is smaller than buildCacheMaxSize,
+// the cached file is touched when it's reused
+func trimBuildCache(cachedir string) error {
+	files, err := ioutil.ReadDir(cachedir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+	var size int64
+	for _, file := range files {
+		size += file.Size()
+		if size <= buildCacheMaxSize {
+			continue
+		}
+		if err = os.Remove(filepath.Join(cachedir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runexec(execfile string, launch *LaunchConfig) (*exec.Cmd, error) {
+	if launch == nil {
+		launch = &LaunchConfig{}
+	}
+	cmd := exec.Command(execfile, launch.args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.Dir = launch.wd
+	if len(launch.env) > 0 {
+		cmd.Env = append(os.Environ(), launch.env...)
+	}
 	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true, Setpgid: true, Foreground: false}
 
+	for fd, filename := range launch.redirects {
+		if filename == "" {
+			continue
+		}
+		var (
+			file *os.File
+			err  error
+		)
+		if fd == 0 {
+			file, err = os.Open(filename)
+		} else {
+			file, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		}
+		if err != nil {
+			logger.Error("runexec:redirect", zap.Error(err), zap.String(redirectNames[fd], filename))
+			return nil, err
+		}
+		// the child process has its own file descriptor after start
+		defer file.Close()
+		switch fd {
+		case 0:
+			cmd.Stdin = file
+		case 1:
+			cmd.Stdout = file
+		case 2:
+			cmd.Stderr = file
+		}
+	}
+
 	// !!! maybe the diffrences of routine and thread in golang
 	runtime.LockOSThread()
 
@@ -77,3 +438,106 @@ func runexec(execfile string) (*exec.Cmd, error) {
 	}
 	return cmd, nil
 }
+
+// execFileOfPid return the executable file of the running process by /proc/<pid>/exe
+func execFileOfPid(pid int) (string, error) {
+	return os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+}
+
+// threadsOfPid return all thread ids in /proc/<pid>/task
+func threadsOfPid(pid int) ([]int, error) {
+	fileInfos, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(fileInfos))
+	for _, fileInfo := range fileInfos {
+		tid, err := strconv.Atoi(fileInfo.Name())
+		if err != nil {
+			continue
+		}
+		tids = append(tids, tid)
+	}
+	return tids, nil
+}
+
+// attach traces every thread of the running process pid.
+// New threads may be created while attaching, so read /proc/<pid>/task again until all of them are traced.
+func attach(pid int) (*exec.Cmd, []int, error) {
+	var (
+		process *os.Process
+		tids    []int
+		err     error
+	)
+
+	// !!! maybe the diffrences of routine and thread in golang
+	runtime.LockOSThread()
+
+	attached := make(map[int]bool)
+	for {
+		if tids, err = threadsOfPid(pid); err != nil {
+			return nil, nil, err
+		}
+		found := false
+		for _, tid := range tids {
+			if attached[tid] {
+				continue
+			}
+			found = true
+			if err = syscall.PtraceAttach(tid); err != nil {
+				logger.Error("attach:PtraceAttach", zap.Error(err), zap.Int("tid", tid))
+				return nil, nil, err
+			}
+			var s syscall.WaitStatus
+			if _, err = syscall.Wait4(tid, &s, syscall.WALL, nil); err != nil {
+				logger.Error("attach:Wait4", zap.Error(err), zap.Int("tid", tid))
+				return nil, nil, err
+			}
+			attached[tid] = true
+		}
+		if !found {
+			break
+		}
+	}
+
+	if process, err = os.FindProcess(pid); err != nil {
+		return nil, nil, err
+	}
+	cmd := &exec.Cmd{Process: process}
+	if cmd.Path, err = execFileOfPid(pid); err != nil {
+		return nil, nil, err
+	}
+	return cmd, tids, nil
+}
+
+// detach restores all the original bytes of breakpoints and releases the traced process.
+func detach() error {
+	var (
+		pc  uint64
+		err error
+		pid = target.cmd.Process.Pid
+		bp  = target.bp
+	)
+
+	if pc, err = getPtracePc(); err != nil {
+		return err
+	}
+	if _, ok := bp.findBreakPoint(pc - 1); ok {
+		if err = setPcRegister(target.cmd, pc-1); err != nil {
+			return err
+		}
+	}
+	for _, v := range bp.infos {
+		if err = bp.disableBreakPoint(pid, v); err != nil {
+			return err
+		}
+	}
+	bp.infos = nil
+	bp.breakpoints = nil
+
+	if err = target.detachAllThreads(); err != nil {
+		return err
+	}
+	target.cmd.Process = nil
+	return nil
+}
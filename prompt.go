@@ -2,18 +2,19 @@ package main
 
 import (
 	"bytes"
-	"debug/dwarf"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/c-bata/go-prompt"
 	"go.uber.org/zap"
 	"golang.org/x/arch/x86/x86asm"
 	"os"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
-	"unsafe"
 )
 
 // executor will exec for input.
@@ -36,7 +37,13 @@ func executor(input string) {
 	switch fs {
 	case 'q':
 		if input == "q" || input == "quit" {
-			if cmd.Process != nil {
+			// the attached process isn't killed even if it can't be detached, godbg quits after reporting the error
+			if cmd.Process != nil && target.attached {
+				if err := detach(); err != nil {
+					printErr(err)
+				}
+			}
+			if cmd.Process != nil && !target.attached {
 				if err := syscall.Kill(cmd.Process.Pid, syscall.SIGKILL); err != nil {
 					// printErr(err)
 				}
@@ -44,30 +51,15 @@ func executor(input string) {
 			if os.Getenv("GODBG_TEST") != "" {
 				return
 			}
+			if target.removeExecFile {
+				_ = os.Remove(target.execFile)
+			}
 			os.Exit(0)
 		}
 	case 'b':
 		sps := strings.Split(input, " ")
-		if len(sps) == 2 && (sps[0] == "b" || sps[0] == "break") {
-			filename, line, err := parseLoc(sps[1])
-			if err != nil {
-				printUnsupportCmd(input)
-				return
-			}
-			if bInfo, err := bp.SetFileLineBreakPoint(bi, pid, filename, line); err != nil {
-				if err == HasExistedBreakPointErr {
-					printHasExistedBreakPoint(sps[1])
-					return
-				}
-				if err == NotFoundSourceLineErr {
-					printNotFoundSourceLineErr(sps[1])
-					return
-				}
-				printErr(err)
-				return
-			} else {
-				fmt.Fprintf(stdout, "godbg add %s:%d breakpoint successfully\n", bInfo.filename, bInfo.lineno)
-			}
+		if len(sps) >= 2 && (sps[0] == "b" || sps[0] == "break") {
+			setBreakPoint(input, sps, pid, false)
 			return
 		}
 		if len(sps) == 2 && (sps[0] == "bc" || sps[0] == "bclear") {
@@ -81,7 +73,8 @@ func executor(input string) {
 				for _, v := range bp.infos {
 					if v.kind == USERBPTYPE {
 						_ = bp.disableBreakPoint(pid, v)
-						if v.pc == curPc-1 {
+						// the thread doesn't trap on the disabled breakpoint
+						if v.pc == curPc-1 && v.enabled() {
 							_ = setPcRegister(cmd, v.pc)
 						}
 					} else {
@@ -89,41 +82,57 @@ func executor(input string) {
 					}
 				}
 				bp.infos = tmp
+				bp.breakpoints = nil
 				return
 			}
 
-			if needClearIndex, err := strconv.Atoi(sps[1]); err == nil {
-				if needClearIndex > len(bp.infos) {
-					printErr(fmt.Errorf("can't find breakpoint index %d", needClearIndex))
+			if id, err := strconv.Atoi(sps[1]); err == nil {
+				b, err := bp.userBreakPoint(id)
+				if err != nil {
+					printErr(err)
+					return
 				}
-				count := 0
-				for i, v := range bp.infos {
-					if v.kind == USERBPTYPE {
-						count++
-						if count == needClearIndex {
-							_ = bp.disableBreakPoint(pid, v)
-							if v.pc == curPc-1 {
-								_ = setPcRegister(cmd, v.pc)
-							}
-							bp.infos = append(bp.infos[:i], bp.infos[(i+1):len(bp.infos)]...)
-							_, _ = fmt.Fprintf(stdout, "clear breakpoint %d successfully, resort breakpoint again\n", needClearIndex)
-							return
-						}
-					}
+				if err = bp.clearUserBreakPoint(pid, b); err != nil {
+					printErr(err)
+					return
 				}
-				printErr(fmt.Errorf("can't find breakpoint index %d", needClearIndex))
+				fmt.Fprintf(stdout, "clear breakpoint %d successfully\n", id)
 				return
 			}
 		}
 		if len(sps) == 1 && (sps[0] == "bl") {
-			count := 0
-			for _, v := range bp.infos {
-				if v.kind == USERBPTYPE {
-					count++
-					fmt.Fprintf(stdout, "%-2d. %s:%d, pc 0x%x\n", count, v.filename, v.lineno, v.pc)
+			// the breakpoint with several locations prints them like `1.1`, `1.2` in the following lines
+			for _, v := range bp.breakpoints {
+				if len(v.locations) == 1 {
+					fmt.Fprintf(stdout, "%-2d. %s:%d, pc 0x%x", v.id, v.filename, v.lineno, v.locations[0].pc)
+				} else {
+					fmt.Fprintf(stdout, "%-2d. %s:%d, %d locations", v.id, v.filename, v.lineno, len(v.locations))
+				}
+				if v.disabled {
+					fmt.Fprintf(stdout, ", disabled")
+				}
+				fmt.Fprintf(stdout, ", hits %d", v.hits)
+				if v.temporary {
+					fmt.Fprintf(stdout, ", temporary")
+				}
+				if v.ignore > 0 {
+					fmt.Fprintf(stdout, ", ignore next %d hits", v.ignore)
+				}
+				if v.hitCond != nil {
+					fmt.Fprintf(stdout, ", stop if %s", v.hitCond)
+				}
+				if v.cond != "" {
+					fmt.Fprintf(stdout, ", if %s", v.cond)
+				}
+				fmt.Fprintln(stdout)
+				if len(v.locations) == 1 {
+					continue
+				}
+				for _, info := range v.locations {
+					fmt.Fprintf(stdout, "    %s pc 0x%x in %s\n", v.locationID(info), info.pc, info.function)
 				}
 			}
-			if count == 0 {
+			if len(bp.breakpoints) == 0 {
 				fmt.Fprintf(stdout, "there is no breakpoint\n")
 			}
 			return
@@ -139,122 +148,246 @@ func executor(input string) {
 			}
 			return
 		}
-		if len(sps) == 1 && sps[0] == "bt" {
+		if sps[0] == "bt" {
+			// bt [-full] [-all] [<depth>]
 			var (
-				rbp      uint64
-				err      error
-				filename string
-				line     int
-				pc       uint64
-				f        *Function
-				ok       bool
+				full, all bool
+				depth     = maxStackDepth
 			)
-			if rbp, err = getPtraceBp(); err != nil {
-				printErr(err)
-				printErr(fmt.Errorf("!!1 %s", err.Error()))
-				return
+			for _, arg := range sps[1:] {
+				switch arg {
+				case "-full":
+					full = true
+				case "-all":
+					all = true
+				default:
+					n, err := strconv.Atoi(arg)
+					if err != nil || n <= 0 {
+						printUnsupportCmd(input)
+						return
+					}
+					depth = n
+				}
 			}
-			if pc, err = getPtracePc(); err != nil {
-				printErr(err)
-				printErr(fmt.Errorf("!!2 %s", err.Error()))
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
 				return
 			}
-
-			if _, ok = bp.findBreakPoint(pc - 1); ok {
-				pc = pc - 1
+			if !all {
+				// the stack of the selected goroutine is unwound by .debug_frame
+				frames, err := target.contextStacktrace(depth)
+				if err != nil {
+					printErr(err)
+					return
+				}
+				printStacktrace(bi, frames, target.curFrame, full)
+				return
 			}
-			if filename, line, err = bi.pcTofileLine(pc); err != nil {
+			// dump all goroutines like the traceback of SIGQUIT
+			gs, err := target.goroutines()
+			if err != nil {
 				printErr(err)
-				printErr(fmt.Errorf("!!3 %s", err.Error()))
 				return
 			}
-			fmt.Fprintf(stdout, "%s:%d\n", filename, line)
-
-			ret := uint64(0)
-			for {
-				if uintptr(rbp) == 0 {
-					break
+			for i, g := range gs {
+				if i > 0 {
+					fmt.Fprintln(stdout)
+				}
+				status := g.statusString()
+				if g.waitReason != "" {
+					status = g.waitReason
 				}
-				original := make([]byte, 16)
-				_, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(rbp), original)
+				fmt.Fprintf(stdout, "goroutine %d [%s]:\n", g.id, status)
+				frames, err := target.goroutineStacktrace(g, depth)
 				if err != nil {
+					fmt.Fprintf(stdout, "  (%s)\n", err)
+					continue
+				}
+				selected := -1
+				if target.isCurGoroutine(g) {
+					selected = target.curFrame
+				}
+				printStacktrace(bi, frames, selected, full)
+			}
+			return
+		}
+	case 'c':
+		sps := strings.Split(input, " ")
+		if len(sps) == 1 && (sps[0] == "c" || sps[0] == "continue") {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			// the breakpoint whose condition is false, or ignored by the hit count, is stepped over,
+			// and the process is resumed again
+			var hit *BInfo
+			for {
+				if err := bp.singleStepInstructionWithBreakpointCheck(pid); err != nil {
 					printErr(err)
 					return
 				}
-				reader := bytes.NewBuffer(original)
-
-				if err = binary.Read(reader, binary.LittleEndian, &rbp); err != nil {
+				if err := bp.Continue(pid); err != nil {
 					printErr(err)
 					return
 				}
-				if err = binary.Read(reader, binary.LittleEndian, &ret); err != nil {
+				_, exited, err := target.waitTrap()
+				if err != nil {
 					printErr(err)
 					return
 				}
-				//fmt.Fprintf(stdout, "ret = %d\n", ret)
-				if filename, line, err = bi.pcTofileLine(ret - 1); err != nil {
-					printErr(err)
+
+				if exited {
+					printExit0(pid)
+					cmd.Process = nil
 					return
 				}
-				if f, err = bi.findFunctionIncludePc(ret - 1); err != nil {
+				info, stop, err := bp.shouldStop(pid)
+				hit = info
+				if err != nil {
 					printErr(err)
-					return
 				}
-				fmt.Fprintf(stdout, "%s:%d %s\n", filename, line, f.name)
+				if stop {
+					break
+				}
 			}
 
+			var (
+				pc  uint64
+				err error
+			)
+			if pc, err = getPtracePc(); err != nil {
+				printErr(err)
+				return
+			}
+			// the location is printed when the line is emitted in several places or inlined
+			if hit != nil && (len(hit.logical.locations) > 1 || strings.Contains(hit.function, " inlined in ")) {
+				fmt.Fprintf(stdout, "breakpoint %s, %s\n", hit.logical.locationID(hit), hit.function)
+			}
+			fmt.Fprintf(stdout, "current process pc = 0x%x\n", pc)
+			if err = listFileLineByPtracePc(target.bi, 6); err != nil {
+				printErr(err)
+				return
+			}
 			return
 		}
-	case 'c':
-		sps := strings.Split(input, " ")
-		if len(sps) == 1 && (sps[0] == "c" || sps[0] == "continue") {
-			if cmd.Process == nil {
-				printNoProcessErr()
+		// `cond <n> <expr>` changes the condition of breakpoint, `cond <n>` removes it
+		if len(sps) >= 2 && sps[0] == "cond" {
+			n, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printUnsupportCmd(input)
 				return
 			}
-			if err := bp.singleStepInstructionWithBreakpointCheck(pid); err != nil {
+			b, err := bp.userBreakPoint(n)
+			if err != nil {
 				printErr(err)
 				return
 			}
-			if err := bp.Continue(pid); err != nil {
+			cond := strings.Join(sps[2:], " ")
+			if err = checkCondition(cond); err != nil {
 				printErr(err)
 				return
 			}
-			var (
-				s  syscall.WaitStatus
-				pc uint64
-			)
-			wpid, err := syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil)
-			if err != nil {
-				printErr(err)
+			b.cond = cond
+			if b.cond == "" {
+				fmt.Fprintf(stdout, "breakpoint %d is unconditional\n", n)
+			} else {
+				fmt.Fprintf(stdout, "breakpoint %d stops if %s\n", n, b.cond)
+			}
+			return
+		}
+		if len(sps) == 1 && sps[0] == "config" {
+			fmt.Fprintf(stdout, "max-depth %d\nmax-array-len %d\nmax-string-len %d\n",
+				loadConfig.MaxDepth, loadConfig.MaxArrayLength, loadConfig.MaxStringLength)
+			return
+		}
+		if len(sps) == 3 && sps[0] == "config" {
+			n, err := strconv.Atoi(sps[2])
+			if err != nil || n < 0 {
+				printUnsupportCmd(input)
 				return
 			}
-
-			if s.Exited() {
-				printExit0(wpid)
-				cmd.Process = nil
+			switch sps[1] {
+			case "max-depth":
+				loadConfig.MaxDepth = n
+			case "max-array-len":
+				loadConfig.MaxArrayLength = n
+			case "max-string-len":
+				loadConfig.MaxStringLength = n
+			default:
+				printUnsupportCmd(input)
 				return
 			}
-
-			if n := s.StopSignal(); n != syscall.SIGTRAP && n != syscall.SIGURG {
-				cmd.Process = nil
-				fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal())
+			fmt.Fprintf(stdout, "%s %d\n", sps[1], n)
+			return
+		}
+		sps = strings.SplitN(input, " ", 2)
+		if len(sps) == 2 && sps[0] == "call" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
 				return
 			}
-
-			if pc, err = getPtracePc(); err != nil {
+			scope, err := newEvalScope(bi)
+			if err != nil {
 				printErr(err)
 				return
 			}
-			fmt.Fprintf(stdout, "current process pc = 0x%x\n", pc)
-			if err = listFileLineByPtracePc(target.bi, 6); err != nil {
+			results, err := scope.evalCallString(sps[1])
+			if err != nil {
 				printErr(err)
 				return
 			}
+			for _, result := range results {
+				fmt.Fprintln(stdout, result.format(loadConfig))
+			}
 			return
 		}
 	case 's':
 		sps := strings.Split(input, " ")
+		if len(sps) == 4 && sps[0] == "set" && sps[1] == "reg" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			if g := target.curGoroutine; g != nil && g.thread == nil {
+				printErr(fmt.Errorf("goroutine %d isn't running on any thread", g.id))
+				return
+			}
+			value, err := strconv.ParseUint(sps[3], 0, 64)
+			if err != nil {
+				n, ierr := strconv.ParseInt(sps[3], 0, 64)
+				if ierr != nil {
+					printErr(err)
+					return
+				}
+				value = uint64(n)
+			}
+			if err = setRegister(sps[2], value); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "%s = 0x%x\n", sps[2], value)
+			return
+		}
+		if len(sps) >= 2 && sps[0] == "set" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			scope, err := newEvalScope(bi)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			expr := strings.TrimSpace(input[len("set"):])
+			variable, err := scope.evalAssign(expr)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			lhs, _, _ := splitAssign(expr)
+			fmt.Fprintf(stdout, "%s = %s\n", lhs, variable.format(loadConfig))
+			return
+		}
 		if len(sps) == 1 && (sps[0] == "s" || sps[0] == "step") {
 			var (
 				err         error
@@ -265,6 +398,7 @@ func executor(input string) {
 				pc          uint64
 				info        *BInfo
 				ok          bool
+				exited      bool
 			)
 			if oldfilename, oldlineno, err = bi.getCurFileLineByPtracePc(); err != nil {
 				printErr(err)
@@ -299,26 +433,16 @@ func executor(input string) {
 						return
 					}
 				}
-				if err = syscall.PtraceSingleStep(cmd.Process.Pid); err != nil {
-					printErr(err)
-					return
-				}
-				var s syscall.WaitStatus
-				if _, err = syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil); err != nil {
+				if exited, err = target.stepThread(target.curTid()); err != nil {
 					printErr(err)
 					return
 				}
-				if s.Exited() {
-					printExit0(cmd.Process.Pid)
+				if exited {
+					printExit0(pid)
 					cmd.Process = nil
 					return
 				}
-				if n := s.StopSignal(); n != syscall.SIGTRAP && n != syscall.SIGURG {
-					printErr(fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal()))
-					return
-				}
 			}
-			return
 		}
 	case 'n':
 		sps := strings.Split(input, " ")
@@ -332,6 +456,7 @@ func executor(input string) {
 				lineno      int
 				oldfilename string
 				oldlineno   int
+				exited      bool
 
 				//f *Function
 				inst x86asm.Inst
@@ -375,24 +500,15 @@ func executor(input string) {
 				}
 
 				if calling == true && pc != callingfpc {
-					if err = syscall.PtraceSingleStep(cmd.Process.Pid); err != nil {
-						printErr(err)
-						return
-					}
-					var s syscall.WaitStatus
-					if _, err = syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil); err != nil {
+					if exited, err = target.stepThread(target.curTid()); err != nil {
 						printErr(err)
 						return
 					}
-					if s.Exited() {
-						printExit0(cmd.Process.Pid)
+					if exited {
+						printExit0(pid)
 						cmd.Process = nil
 						return
 					}
-					if n := s.StopSignal(); n != syscall.SIGTRAP && n != syscall.SIGURG {
-						printErr(fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal()))
-						return
-					}
 				} else if calling == true && pc == callingfpc {
 					calling = false
 					if filename, lineno, err = bi.pcTofileLine(pc); err != nil {
@@ -417,24 +533,15 @@ func executor(input string) {
 						continue
 					}
 
-					if err = syscall.PtraceSingleStep(cmd.Process.Pid); err != nil {
-						printErr(err)
-						return
-					}
-					var s syscall.WaitStatus
-					if _, err = syscall.Wait4(cmd.Process.Pid, &s, syscall.WALL, nil); err != nil {
+					if exited, err = target.stepThread(target.curTid()); err != nil {
 						printErr(err)
 						return
 					}
-					if s.Exited() {
-						printExit0(cmd.Process.Pid)
+					if exited {
+						printExit0(pid)
 						cmd.Process = nil
 						return
 					}
-					if n := s.StopSignal(); n != syscall.SIGTRAP && n != syscall.SIGURG {
-						printErr(fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal()))
-						return
-					}
 					if filename, lineno, err = bi.pcTofileLine(pc + uint64(inst.Len)); err != nil {
 						printErr(err)
 						return
@@ -451,6 +558,19 @@ func executor(input string) {
 		}
 	case 'l':
 		sps := strings.Split(input, " ")
+		if len(sps) == 1 && sps[0] == "locals" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			scope, err := newEvalScope(bi)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			printLocals(scope, scope.locals(false))
+			return
+		}
 		if len(sps) == 1 && (sps[0] == "l" || sps[0] == "list") {
 			if err := listFileLineByPtracePc(target.bi, 6); err != nil {
 				printErr(err)
@@ -491,35 +611,110 @@ func executor(input string) {
 		}
 	case 'r':
 		sps := strings.Split(input, " ")
-		if len(sps) == 1 && (sps[0] == "r" || sps[0] == "restart") {
+		// `rbreak <regex>` sets the breakpoints at the functions matching regex
+		if len(sps) == 2 && sps[0] == "rbreak" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			re, err := regexp.Compile(sps[1])
+			if err != nil {
+				printErr(err)
+				return
+			}
+			count := 0
+			for _, f := range bi.functionsMatching(re) {
+				b, err := bp.SetFunctionBreakPoint(bi, pid, f)
+				if err == HasExistedBreakPointErr {
+					continue
+				}
+				if err != nil {
+					printErr(fmt.Errorf("can't set breakpoint at %s: %s", f.name, err.Error()))
+					continue
+				}
+				count++
+				fmt.Fprintf(stdout, "%-2d. %s %s:%d\n", b.id, f.name, b.filename, b.lineno)
+			}
+			fmt.Fprintf(stdout, "godbg add %d breakpoints successfully\n", count)
+			return
+		}
+		if len(sps) >= 1 && (sps[0] == "r" || sps[0] == "restart") {
+			if target.attached {
+				printErr(errors.New("can't restart the attached process"))
+				return
+			}
+			// `r -- newargs` changes the arguments of programe, others of launch config are reused
+			if len(sps) > 1 {
+				if sps[1] != "--" {
+					printUnsupportCmd(input)
+					return
+				}
+				args := make([]string, 0, len(sps)-2)
+				for _, arg := range sps[2:] {
+					if arg != "" {
+						args = append(args, arg)
+					}
+				}
+				target.launch.args = args
+			}
 			pid := 0
 			if cmd.Process != nil {
 				pid = cmd.Process.Pid
-				if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGSTOP); err != nil {
-					err = nil
-					//printErr(err)
-					//return
+				if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err == nil {
+					// the process isn't reaped until all its traced threads are reaped
+					var s syscall.WaitStatus
+					for {
+						wpid, err := syscall.Wait4(-1, &s, syscall.WALL, nil)
+						if err != nil || (wpid == pid && (s.Exited() || s.Signaled())) {
+							break
+						}
+					}
 				}
 			}
 			if pid != 0 {
 				fmt.Fprintf(stdout, "  stop  old process pid %d\n", pid)
 			}
 			var err error
-			if cmd, err = runexec(target.execFile); err != nil {
+			if target.cmd, err = runexec(target.execFile, target.launch); err != nil {
 				printErr(err)
 				logger.Error(err.Error(), zap.String("stage", "restart:runexec"), zap.String("execfile", target.execFile))
 				return
 			}
+			if err = target.initThreads([]int{target.cmd.Process.Pid}); err != nil {
+				printErr(err)
+				logger.Error(err.Error(), zap.String("stage", "restart:initThreads"), zap.String("execfile", target.execFile))
+				return
+			}
 			if err = bp.SetBpWhenRestart(target.cmd.Process.Pid); err != nil {
 				printErr(err)
 				logger.Error(err.Error(), zap.String("stage", "restart:setbp"), zap.String("execfile", target.execFile))
 				return
 			}
-			fmt.Fprintf(stdout, "restart new process pid %d \n", cmd.Process.Pid)
+			fmt.Fprintf(stdout, "restart new process pid %d \n", target.cmd.Process.Pid)
 			return
 		}
 	case 'd':
 		sps := strings.Split(input, " ")
+		if len(sps) == 1 && sps[0] == "detach" {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			if err := detach(); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "detach process %d successfully\n", pid)
+			return
+		}
+		if len(sps) == 2 && sps[0] == "disable" {
+			switchBreakPoints(input, sps, pid, false)
+			return
+		}
+		if len(sps) <= 2 && sps[0] == "down" {
+			switchFrame(input, sps, -1)
+			return
+		}
 		if len(sps) == 1 && (sps[0] == "disass" || sps[0] == "disassemble") {
 			if err := listDisassembleByPtracePc(target.bi, target.bp, target.cmd.Process.Pid); err != nil {
 				printErr(err)
@@ -527,88 +722,230 @@ func executor(input string) {
 			}
 			return
 		}
-	case 'p':
+	case 'e':
+		sps := strings.Split(input, " ")
+		if len(sps) == 2 && sps[0] == "enable" {
+			switchBreakPoints(input, sps, pid, true)
+			return
+		}
+	case 'i':
+		sps := strings.Split(input, " ")
+		// `ignore <n> <count>` passes the next count hits of breakpoint n
+		if len(sps) == 3 && sps[0] == "ignore" {
+			n, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printUnsupportCmd(input)
+				return
+			}
+			count, err := strconv.Atoi(sps[2])
+			if err != nil || count < 0 {
+				printUnsupportCmd(input)
+				return
+			}
+			b, err := bp.userBreakPoint(n)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			b.ignore = count
+			fmt.Fprintf(stdout, "breakpoint %d will ignore next %d hits\n", n, count)
+			return
+		}
+	case 'f':
 		sps := strings.Split(input, " ")
+		if len(sps) == 2 && sps[0] == "frame" {
+			switchFrame(input, sps, 0)
+			return
+		}
+	case 'u':
+		sps := strings.Split(input, " ")
+		if len(sps) <= 2 && sps[0] == "up" {
+			switchFrame(input, sps, 1)
+			return
+		}
+	case 'p':
+		sps := strings.SplitN(input, " ", 2)
 		if len(sps) == 2 && (sps[0] == "p" || sps[0] == "print") {
-			var (
-				v     string
-				pc    uint64
-				err   error
-				ok    bool
-				f     *Function
-				frame *Frame
-			)
-			v = sps[1]
-			if pc, err = getPtracePc(); err != nil {
+			scope, err := newEvalScope(bi)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			variable, err := scope.evalString(sps[1])
+			if err != nil {
 				printErr(err)
 				return
 			}
-			if _, ok = bp.findBreakPoint(pc - 1); ok {
-				pc--
+			fmt.Fprintln(stdout, variable.format(loadConfig))
+			return
+		}
+	case 't':
+		sps := strings.Split(input, " ")
+		if len(sps) >= 2 && sps[0] == "tbreak" {
+			setBreakPoint(input, sps, pid, true)
+			return
+		}
+		if len(sps) == 1 && sps[0] == "threads" {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			for _, thread := range target.sortedThreads() {
+				var regs syscall.PtraceRegs
+				if err := syscall.PtraceGetRegs(thread.tid, &regs); err != nil {
+					printErr(err)
+					return
+				}
+				flag := " "
+				if thread == target.curThread {
+					flag = "*"
+				}
+				filename, lineno, _ := bi.pcTofileLine(regs.PC())
+				fname := ""
+				if f, err := bi.findFunctionIncludePc(regs.PC()); err == nil {
+					fname = f.name
+				}
+				fmt.Fprintf(stdout, "%s Thread %d at 0x%x %s:%d %s\n", flag, thread.tid, regs.PC(), filename, lineno, fname)
+			}
+			return
+		}
+		if len(sps) == 2 && sps[0] == "thread" {
+			tid, err := strconv.Atoi(sps[1])
+			if err != nil {
+				printUnsupportCmd(input)
+				return
 			}
-			if frame, err = bi.findFrameInformation(pc); err != nil {
+			if err = target.switchThread(tid); err != nil {
 				printErr(err)
 				return
 			}
-			if f, err = bi.findFunctionIncludePc(pc); err != nil {
+			fmt.Fprintf(stdout, "switch to thread %d\n", tid)
+			if err = listFileLineByPtracePc(target.bi, 6); err != nil {
 				printErr(err)
 				return
 			}
-			for _, fv := range f.variables {
-				isFound := false
-				if field := fv.AttrField(dwarf.AttrName); field != nil {
-					if fieldstr, ok := field.Val.(string); ok && fieldstr == v {
-						isFound = true
-					}
+			return
+		}
+	case 'g':
+		sps := strings.Split(input, " ")
+		if len(sps) == 1 && sps[0] == "goroutines" {
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			gs, err := target.goroutines()
+			if err != nil {
+				printErr(err)
+				return
+			}
+			for _, g := range gs {
+				pc, err := g.location()
+				if err != nil {
+					printErr(err)
+					return
 				}
-				if isFound {
-					var (
-						opcode byte
-					)
-					field := fv.AttrField(dwarf.AttrLocation)
-					buf := bytes.NewBuffer(field.Val.([]byte))
-					if opcode, err = buf.ReadByte(); err != nil {
-						printErr(err)
-						return
-					}
-					switch opcode {
-					case DW_OP_fbreg:
-						num, _, _ := DecodeSLEB128(buf)
-						address := int64(frame.framebase) + num
-						// if the type is `string`
-						val := make([]byte, 8)
-						if _, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(address)+uintptr(8), val); err != nil {
-							printErr(err)
-							return
-						}
-						strlen := int64(binary.LittleEndian.Uint64(val))
-						if strlen < 0 {
-							printErr(fmt.Errorf("strlen %d shoulde be < 0", strlen))
-							return
-						}
-						// read addr
-						if _, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(address), val); err != nil {
-							printErr(err)
-							return
-						}
-						addr := uintptr(binary.LittleEndian.Uint64(val))
-						if addr == 0 {
-							printErr(fmt.Errorf("pointer addr %d shoulde be == 0", addr))
-							return
-						}
-						logger.Debug(fmt.Sprintf("address = %d,  len = %d, addr = %d,, num = %d\n", address, strlen, addr, num))
-
-						strpointer := make([]byte, strlen)
-						if _, err = syscall.PtracePeekData(cmd.Process.Pid, uintptr(addr), strpointer); err != nil {
-							printErr(err)
-							return
-						}
-						fmt.Fprintf(stdout, "%v\n", *(*string)(unsafe.Pointer(&strpointer)))
-						return
-					}
-					fmt.Fprintf(stderr, "not support dwarf variable %#v", fv)
+				flag := " "
+				if target.isCurGoroutine(g) {
+					flag = "*"
+				}
+				filename, lineno, _ := bi.pcTofileLine(pc)
+				fname := ""
+				if f, err := bi.findFunctionIncludePc(pc); err == nil {
+					fname = f.name
+				}
+				reason := ""
+				if g.waitReason != "" {
+					reason = fmt.Sprintf(" [%s]", g.waitReason)
+				}
+				fmt.Fprintf(stdout, "%s Goroutine %d %s at 0x%x %s:%d %s%s\n",
+					flag, g.id, g.statusString(), pc, filename, lineno, fname, reason)
+			}
+			return
+		}
+		if len(sps) == 2 && sps[0] == "goroutine" {
+			id, err := strconv.ParseUint(sps[1], 10, 64)
+			if err != nil {
+				printUnsupportCmd(input)
+				return
+			}
+			if cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			if err = target.switchGoroutine(id); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "switch to goroutine %d\n", id)
+			if err = listFileLineByPtracePc(target.bi, 6); err != nil {
+				printErr(err)
+				return
+			}
+			return
+		}
+	case 'a':
+		if input == "args" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			scope, err := newEvalScope(bi)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			printLocals(scope, scope.locals(true))
+			return
+		}
+	case 'v':
+		sps := strings.Split(input, " ")
+		if len(sps) <= 2 && sps[0] == "vars" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			pattern := ""
+			if len(sps) == 2 {
+				pattern = sps[1]
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			for _, name := range bi.globalNames(re) {
+				addr, typ, err := bi.findGlobalVariable(name)
+				if err != nil {
+					fmt.Fprintf(stdout, "%s = (%s)\n", name, err)
+					continue
 				}
+				fmt.Fprintf(stdout, "%s = %s\n", name, newVariable(name, addr, typ).format(loadConfig))
+			}
+			return
+		}
+	case 'w':
+		sps := strings.Fields(input)
+		if len(sps) >= 3 && sps[0] == "write" {
+			if cmd == nil || cmd.Process == nil {
+				printNoProcessErr()
+				return
+			}
+			addr, err := strconv.ParseUint(sps[1], 0, 64)
+			if err != nil {
+				printErr(err)
+				return
+			}
+			// the bytes are hex like `0x9090` or `90 90`
+			data, err := hex.DecodeString(strings.TrimPrefix(strings.Join(sps[2:], ""), "0x"))
+			if err != nil {
+				printErr(err)
+				return
 			}
+			if err = target.writeMemory(addr, data); err != nil {
+				printErr(err)
+				return
+			}
+			fmt.Fprintf(stdout, "write %d bytes at 0x%x\n", len(data), addr)
 			return
 		}
 	case 'h':
@@ -621,6 +958,129 @@ func executor(input string) {
 	printUnsupportCmd(input)
 }
 
+// setBreakPoint handles `b <loc> [hits<op>N] [if <expr>]`, `tbreak` sets the temporary breakpoint by the same form.
+// The breakpoint stops when the condition is true and the hit count matches, loc is resolved by BP.SetBreakPoint.
+func setBreakPoint(input string, sps []string, pid int, temporary bool) {
+	var (
+		err     error
+		hitCond *hitCondition
+		cond    string
+		rest    = sps[2:]
+	)
+	if len(rest) > 0 && strings.HasPrefix(rest[0], "hits") {
+		if hitCond, err = parseHitCondition(rest[0]); err != nil {
+			printErr(err)
+			return
+		}
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		if rest[0] != "if" || len(rest) == 1 {
+			printUnsupportCmd(input)
+			return
+		}
+		cond = strings.Join(rest[1:], " ")
+	}
+	if err = checkCondition(cond); err != nil {
+		printErr(err)
+		return
+	}
+	b, err := target.bp.SetBreakPoint(target.bi, pid, sps[1])
+	if err != nil {
+		if err == HasExistedBreakPointErr {
+			printHasExistedBreakPoint(sps[1])
+			return
+		}
+		if err == NotFoundSourceLineErr {
+			printNotFoundSourceLineErr(sps[1])
+			return
+		}
+		printErr(err)
+		return
+	}
+	b.cond, b.hitCond, b.temporary = cond, hitCond, temporary
+	if len(b.locations) > 1 {
+		fmt.Fprintf(stdout, "godbg add %s:%d breakpoint at %d locations successfully\n", b.filename, b.lineno, len(b.locations))
+		return
+	}
+	fmt.Fprintf(stdout, "godbg add %s:%d breakpoint successfully\n", b.filename, b.lineno)
+}
+
+// switchBreakPoints handles `enable <n>`, `disable <n>`, `enable all` and `disable all`
+func switchBreakPoints(input string, sps []string, pid int, enable bool) {
+	if target.cmd == nil || target.cmd.Process == nil {
+		printNoProcessErr()
+		return
+	}
+	var breakpoints []*BreakPoint
+	if sps[1] == "all" {
+		breakpoints = append(breakpoints, target.bp.breakpoints...)
+	} else {
+		id, err := strconv.Atoi(sps[1])
+		if err != nil {
+			printUnsupportCmd(input)
+			return
+		}
+		b, err := target.bp.userBreakPoint(id)
+		if err != nil {
+			printErr(err)
+			return
+		}
+		breakpoints = append(breakpoints, b)
+	}
+	for _, b := range breakpoints {
+		var err error
+		if enable {
+			err = target.bp.enableUserBreakPoint(pid, b)
+		} else {
+			err = target.bp.disableUserBreakPoint(pid, b)
+		}
+		if err != nil {
+			printErr(err)
+			return
+		}
+	}
+	state := "disabled"
+	if enable {
+		state = "enabled"
+	}
+	if sps[1] == "all" {
+		fmt.Fprintf(stdout, "%d breakpoints are %s\n", len(breakpoints), state)
+		return
+	}
+	fmt.Fprintf(stdout, "breakpoint %s is %s\n", sps[1], state)
+}
+
+// switchFrame handles `frame <n>`, `up [n]` and `down [n]`, direction is 0 for frame, 1 for up and -1 for down.
+// The source of the selected frame is listed.
+func switchFrame(input string, sps []string, direction int) {
+	if target.cmd == nil || target.cmd.Process == nil {
+		printNoProcessErr()
+		return
+	}
+	n := 1
+	if len(sps) == 2 {
+		var err error
+		if n, err = strconv.Atoi(sps[1]); err != nil || n < 0 {
+			printUnsupportCmd(input)
+			return
+		}
+	}
+	depth := n
+	if direction != 0 {
+		depth = target.curFrame + direction*n
+	}
+	frame, err := target.switchFrame(depth)
+	if err != nil {
+		printErr(err)
+		return
+	}
+	fmt.Fprintf(stdout, "frame %d %s\n", depth, frame.fn.name)
+	if err = listFileLineByPtracePc(target.bi, 6); err != nil {
+		printErr(err)
+	}
+}
+
 func complete(docs prompt.Document) []prompt.Suggest {
 	sps := strings.Split(docs.Text, " ")
 
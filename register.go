@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os/exec"
 	"syscall"
+	"unsafe"
 )
 
 func getRegisters(cmd *exec.Cmd) (syscall.PtraceRegs, error) {
@@ -10,10 +12,80 @@ func getRegisters(cmd *exec.Cmd) (syscall.PtraceRegs, error) {
 	if cmd.Process == nil {
 		return prs, NoProcessRuning
 	}
-	err := syscall.PtraceGetRegs(cmd.Process.Pid, &prs)
+	err := syscall.PtraceGetRegs(target.curTid(), &prs)
 	return prs, err
 }
 
+// getContextRegisters return the registers of the selected goroutine, which are used by bt, list and print.
+// The parked goroutine only has pc, sp and bp saved in `g.sched`.
+func getContextRegisters() (syscall.PtraceRegs, error) {
+	if g := target.curGoroutine; g != nil && g.thread == nil {
+		var prs syscall.PtraceRegs
+		prs.Rip, prs.Rsp, prs.Rbp = g.pc, g.sp, g.bp
+		return prs, nil
+	}
+	return getRegisters(target.cmd)
+}
+
+// getContextDwarfRegisters return the registers of the selected goroutine in DWARF order.
+// The xmm registers are read only when the goroutine is running on thread.
+func getContextDwarfRegisters() (*dwarfRegisters, error) {
+	if target.cmd.Process == nil {
+		return nil, NoProcessRuning
+	}
+	if g := target.curGoroutine; g != nil && g.thread == nil {
+		return getGoroutineDwarfRegisters(g)
+	}
+	return getThreadDwarfRegisters(target.curTid())
+}
+
+// getGoroutineDwarfRegisters return the registers of goroutine, the parked goroutine only has pc, sp and bp
+func getGoroutineDwarfRegisters(g *Goroutine) (*dwarfRegisters, error) {
+	if g.thread != nil {
+		return getThreadDwarfRegisters(g.thread.tid)
+	}
+	regs := newDwarfRegisters(&syscall.PtraceRegs{Rip: g.pc, Rsp: g.sp, Rbp: g.bp})
+	for reg := range regs.unavailable {
+		regs.unavailable[reg] = reg != dwarfRegRip && reg != dwarfRegRsp && reg != dwarfRegRbp
+	}
+	return regs, nil
+}
+
+// getThreadDwarfRegisters return the registers of thread including xmm registers
+func getThreadDwarfRegisters(tid int) (*dwarfRegisters, error) {
+	var prs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(tid, &prs); err != nil {
+		return nil, err
+	}
+	regs := newDwarfRegisters(&prs)
+	var err error
+	if regs.xmm, err = getXmmRegisters(tid); err != nil {
+		return nil, err
+	}
+	return regs, nil
+}
+
+func newDwarfRegisters(prs *syscall.PtraceRegs) *dwarfRegisters {
+	return &dwarfRegisters{gp: [dwarfRegRip + 1]uint64{
+		prs.Rax, prs.Rdx, prs.Rcx, prs.Rbx, prs.Rsi, prs.Rdi, prs.Rbp, prs.Rsp,
+		prs.R8, prs.R9, prs.R10, prs.R11, prs.R12, prs.R13, prs.R14, prs.R15, prs.Rip,
+	}, fsBase: prs.Fs_base}
+}
+
+// getXmmRegisters reads xmm0 ... xmm15 from `struct user_fpregs_struct`, they are at offset 160
+func getXmmRegisters(tid int) ([][]byte, error) {
+	buf := make([]byte, 512)
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_GETFPREGS, uintptr(tid), 0, uintptr(unsafe.Pointer(&buf[0])), 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	xmm := make([][]byte, 16)
+	for i := range xmm {
+		xmm[i] = buf[160+i*16 : 176+i*16]
+	}
+	return xmm, nil
+}
+
 func getPtracePc() (uint64, error) {
 	var (
 		prs syscall.PtraceRegs
@@ -26,6 +98,11 @@ func getPtracePc() (uint64, error) {
 }
 
 func setPcRegister(cmd *exec.Cmd, pc uint64) error {
+	return setRegister("rip", pc)
+}
+
+// setRegister changes the register of current thread, the name is like `rax`, `pc` or `eflags`
+func setRegister(name string, value uint64) error {
 	var (
 		prs syscall.PtraceRegs
 		err error
@@ -33,8 +110,25 @@ func setPcRegister(cmd *exec.Cmd, pc uint64) error {
 	if prs, err = getRegisters(target.cmd); err != nil {
 		return err
 	}
-	prs.SetPC(pc)
-	return syscall.PtraceSetRegs(cmd.Process.Pid, &prs)
+	reg, ok := registerFields(&prs)[name]
+	if !ok {
+		return fmt.Errorf("unknown register %s", name)
+	}
+	*reg = value
+	return syscall.PtraceSetRegs(target.curTid(), &prs)
+}
+
+// registerFields maps the register names to the fields of PtraceRegs
+func registerFields(prs *syscall.PtraceRegs) map[string]*uint64 {
+	return map[string]*uint64{
+		"rax": &prs.Rax, "rbx": &prs.Rbx, "rcx": &prs.Rcx, "rdx": &prs.Rdx,
+		"rsi": &prs.Rsi, "rdi": &prs.Rdi, "rbp": &prs.Rbp, "rsp": &prs.Rsp,
+		"r8": &prs.R8, "r9": &prs.R9, "r10": &prs.R10, "r11": &prs.R11,
+		"r12": &prs.R12, "r13": &prs.R13, "r14": &prs.R14, "r15": &prs.R15,
+		"rip": &prs.Rip, "pc": &prs.Rip, "sp": &prs.Rsp, "bp": &prs.Rbp,
+		"eflags": &prs.Eflags, "orig_rax": &prs.Orig_rax, "fs_base": &prs.Fs_base, "gs_base": &prs.Gs_base,
+		"cs": &prs.Cs, "ss": &prs.Ss, "ds": &prs.Ds, "es": &prs.Es, "fs": &prs.Fs, "gs": &prs.Gs,
+	}
 }
 
 func getPtraceBp() (uint64, error) {
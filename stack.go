@@ -0,0 +1,302 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// the outermost functions of goroutine and thread, the unwinding stops at them
+var outermostFunctions = map[string]bool{
+	"runtime.goexit": true,
+	"runtime.mstart": true,
+	"runtime.rt0_go": true,
+}
+
+// maxStackDepth limits the frames of bt
+const maxStackDepth = 100
+
+// backtraceLoadConfig is the short config to print the variables of frames in bt
+var backtraceLoadConfig = LoadConfig{MaxDepth: 1, MaxArrayLength: 4, MaxStringLength: 32}
+
+// stackFrame is a frame of the call stack
+type stackFrame struct {
+	// pc is the current pc of the innermost frame, or the return address of the caller frame
+	pc    uint64
+	cfa   uint64
+	fn    *Function
+	depth int
+	// regs are the registers recovered in this frame
+	regs *dwarfRegisters
+}
+
+// lookupPc return the pc to find the function and the line, the return address may be the first instruction of next line
+func (f *stackFrame) lookupPc() uint64 {
+	if f.depth == 0 {
+		return f.pc
+	}
+	return f.pc - 1
+}
+
+// contextStacktrace unwinds the stack of the selected goroutine
+func (t *Target) contextStacktrace(depth int) ([]*stackFrame, error) {
+	regs, err := getContextDwarfRegisters()
+	if err != nil {
+		return nil, err
+	}
+	return t.stacktrace(t.rewindBreakPointPc(regs), depth)
+}
+
+// goroutineStacktrace unwinds the stack of goroutine
+func (t *Target) goroutineStacktrace(g *Goroutine, depth int) ([]*stackFrame, error) {
+	regs, err := getGoroutineDwarfRegisters(g)
+	if err != nil {
+		return nil, err
+	}
+	return t.stacktrace(t.rewindBreakPointPc(regs), depth)
+}
+
+// rewindBreakPointPc moves the pc back to the breakpoint if the thread traps on it
+func (t *Target) rewindBreakPointPc(regs *dwarfRegisters) *dwarfRegisters {
+	if _, ok := t.bp.findBreakPoint(regs.gp[dwarfRegRip] - 1); ok {
+		regs.gp[dwarfRegRip]--
+	}
+	return regs
+}
+
+// selectedFrame return the frame selected by `frame <n>`, `up` and `down` in the selected goroutine
+func (t *Target) selectedFrame() (*stackFrame, error) {
+	frames, err := t.contextStacktrace(t.curFrame + 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) <= t.curFrame {
+		return nil, fmt.Errorf("there is no frame %d", t.curFrame)
+	}
+	return frames[t.curFrame], nil
+}
+
+// selectedPc return the pc of the selected frame, it's the pc of the selected goroutine for the innermost frame
+func (t *Target) selectedPc() (uint64, error) {
+	if t.curFrame == 0 {
+		regs, err := getContextRegisters()
+		return regs.PC(), err
+	}
+	frame, err := t.selectedFrame()
+	if err != nil {
+		return 0, err
+	}
+	return frame.lookupPc(), nil
+}
+
+// switchFrame selects the frame at depth of the call stack
+func (t *Target) switchFrame(depth int) (*stackFrame, error) {
+	if depth < 0 {
+		return nil, errors.New("the innermost frame has been selected")
+	}
+	frames, err := t.contextStacktrace(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) <= depth {
+		return nil, errors.New("the outermost frame has been selected")
+	}
+	t.curFrame = depth
+	return frames[depth], nil
+}
+
+// stacktrace unwinds the call stack from regs by the CFI of .debug_frame and .eh_frame, it return at most depth frames.
+// The pc of regs should be moved back if the thread traps on breakpoint.
+func (t *Target) stacktrace(regs *dwarfRegisters, depth int) ([]*stackFrame, error) {
+	var frames []*stackFrame
+	for len(frames) < depth {
+		frame := &stackFrame{pc: regs.gp[dwarfRegRip], regs: regs, depth: len(frames)}
+		pc := frame.lookupPc()
+		fn, err := t.bi.findFunctionIncludePc(pc)
+		if err != nil {
+			if len(frames) == 0 {
+				return nil, err
+			}
+			break
+		}
+		rules, err := t.bi.findFrameInformation(pc)
+		if err != nil {
+			if len(frames) == 0 {
+				return nil, err
+			}
+			break
+		}
+		if frame.cfa, err = rules.computeCFA(regs, t.readMemory); err != nil {
+			return nil, err
+		}
+		frame.fn = fn
+		regs.cfa = frame.cfa
+		frames = append(frames, frame)
+
+		if outermostFunctions[fn.name] {
+			break
+		}
+		if regs, err = rules.unwind(regs, frame.cfa, t.readMemory); err != nil {
+			return nil, err
+		}
+		if regs.gp[dwarfRegRip] == 0 {
+			break
+		}
+	}
+	return frames, nil
+}
+
+// readMemoryFunc reads the memory of process, it's replaced in the tests
+type readMemoryFunc func(addr uint64, size int) ([]byte, error)
+
+// computeCFA return the canonical frame address by the cfa rule
+func (frame *Frame) computeCFA(regs *dwarfRegisters, readMemory readMemoryFunc) (uint64, error) {
+	switch frame.cfa.rule {
+	case RuleCFA:
+		reg, err := regs.uint(frame.cfa.reg)
+		if err != nil {
+			return 0, err
+		}
+		return reg + uint64(frame.cfa.offset), nil
+	case RuleExpression:
+		loc, err := evalLocation(frame.cfa.expression, regs, readMemory)
+		if err != nil {
+			return 0, err
+		}
+		if loc.kind != locMemory {
+			return 0, fmt.Errorf("the cfa expression isn't a value")
+		}
+		return loc.addr, nil
+	default:
+		return 0, fmt.Errorf("invalid cfa rule %v", frame.cfa.rule)
+	}
+}
+
+// evalRuleExpression evaluates the expression of register rule, the cfa is pushed on the stack at first
+func evalRuleExpression(expr []byte, regs *dwarfRegisters, cfa uint64, readMemory readMemoryFunc) (uint64, error) {
+	withCFA := *regs
+	withCFA.cfa = cfa
+	loc, err := evalLocation(append([]byte{DW_OP_call_frame_cfa}, expr...), &withCFA, readMemory)
+	if err != nil {
+		return 0, err
+	}
+	if loc.kind != locMemory {
+		return 0, fmt.Errorf("the register expression isn't a value")
+	}
+	return loc.addr, nil
+}
+
+// unwind recovers the registers of the caller by the register rules.
+// There is no callee-saved register in go ABI, so the register without rule is unavailable,
+// except rbp which is saved under the return address by go functions.
+func (frame *Frame) unwind(regs *dwarfRegisters, cfa uint64, readMemory readMemoryFunc) (*dwarfRegisters, error) {
+	caller := &dwarfRegisters{fsBase: regs.fsBase}
+	for reg := range caller.unavailable {
+		caller.unavailable[reg] = true
+	}
+	rules := make(map[uint64]DWRule, len(frame.regsRule)+1)
+	for reg, rule := range frame.regsRule {
+		rules[reg] = rule
+	}
+	if _, ok := rules[dwarfRegRbp]; !ok {
+		rules[dwarfRegRbp] = DWRule{rule: RuleFramePointer, offset: -16}
+	}
+	if _, ok := rules[frame.cie.return_address_register]; !ok {
+		rules[frame.cie.return_address_register] = DWRule{rule: RuleOffset, offset: -8}
+	}
+
+	for reg, rule := range rules {
+		if reg > dwarfRegRip {
+			continue
+		}
+		var (
+			value uint64
+			err   error
+		)
+		switch rule.rule {
+		case RuleUndefined:
+			continue
+		case RuleSameVal:
+			if regs.unavailable[reg] {
+				continue
+			}
+			value = regs.gp[reg]
+		case RuleOffset:
+			value, err = readUint64(readMemory, cfa+uint64(rule.offset))
+		case RuleValOffset:
+			value = cfa + uint64(rule.offset)
+		case RuleRegister:
+			if rule.reg <= dwarfRegRip && regs.unavailable[rule.reg] {
+				continue
+			}
+			value, err = regs.uint(rule.reg)
+		case RuleExpression:
+			var addr uint64
+			if addr, err = evalRuleExpression(rule.expression, regs, cfa, readMemory); err == nil {
+				value, err = readUint64(readMemory, addr)
+			}
+		case RuleValExpression:
+			value, err = evalRuleExpression(rule.expression, regs, cfa, readMemory)
+		case RuleFramePointer:
+			// the frame pointer is saved only after the prologue, rbp is still the caller's before that
+			value = regs.gp[reg]
+			if value <= cfa {
+				value, err = readUint64(readMemory, cfa+uint64(rule.offset))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule %v of register %d", rule.rule, reg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		caller.gp[reg], caller.unavailable[reg] = value, false
+	}
+	caller.gp[dwarfRegRip] = caller.gp[frame.cie.return_address_register]
+	caller.gp[dwarfRegRsp] = cfa
+	caller.unavailable[dwarfRegRip], caller.unavailable[dwarfRegRsp] = false, false
+	return caller, nil
+}
+
+// printStacktrace prints the frames like `* 0  0x00000000004b6315 /path/main.go:6 main.leaf(n = 4)`,
+// `*` is the selected frame. The local variables are printed under the frame if full.
+func printStacktrace(bi *BI, frames []*stackFrame, selected int, full bool) {
+	for _, frame := range frames {
+		mark := "  "
+		if frame.depth == selected {
+			mark = "* "
+		}
+		filename, line, err := bi.pcTofileLine(frame.lookupPc())
+		if err != nil {
+			filename, line = "?", 0
+		}
+		scope, err := newFrameScope(bi, frame)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s%-2d 0x%016x %s:%d %s(%s)\n", mark, frame.depth, frame.pc, filename, line, frame.fn.name, err)
+			continue
+		}
+		// the return values are skipped, they aren't set until the function returns
+		args := make([]string, 0)
+		for _, lv := range scope.locals(true) {
+			if isResult, _ := lv.entry.Val(dwarf.AttrVarParam).(bool); !isResult {
+				args = append(args, fmt.Sprintf("%s = %s", lv.name, scope.formatLocal(lv, backtraceLoadConfig)))
+			}
+		}
+		fmt.Fprintf(stdout, "%s%-2d 0x%016x %s:%d %s(%s)\n", mark, frame.depth, frame.pc, filename, line, frame.fn.name, strings.Join(args, ", "))
+		if !full {
+			continue
+		}
+		for _, lv := range scope.locals(false) {
+			fmt.Fprintf(stdout, "        %s = %s\n", lv.name, scope.formatLocal(lv, backtraceLoadConfig))
+		}
+	}
+}
+
+func readUint64(readMemory readMemoryFunc, addr uint64) (uint64, error) {
+	buf, err := readMemory(addr, 8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/binary"
 	"os/exec"
+	"syscall"
 )
 
 type Target struct {
@@ -9,4 +11,65 @@ type Target struct {
 	bi       *BI
 	cmd      *exec.Cmd
 	execFile string
+	launch   *LaunchConfig
+	// removeExecFile is true when execFile is built out of the cache, it's removed when quit
+	removeExecFile bool
+
+	// attached is true when the process is traced by `godbg attach`,
+	// it should be detached rather than killed when quit.
+	attached bool
+
+	// threads are all traced threads, the registers are read from curThread
+	threads   map[int]*Thread
+	curThread *Thread
+
+	// curGoroutine is selected by `goroutine <id>`, it's cleared when the process is resumed
+	curGoroutine *Goroutine
+	// curFrame is the depth of frame selected by `frame <n>`, `up` and `down`,
+	// it's reset when the process is resumed or another goroutine is selected
+	curFrame int
+}
+
+// readMemory reads size bytes at addr of the process
+func (t *Target) readMemory(addr uint64, size int) ([]byte, error) {
+	buf := make([]byte, size)
+	if size == 0 {
+		return buf, nil
+	}
+	if _, err := syscall.PtracePeekData(t.cmd.Process.Pid, uintptr(addr), buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// writeMemory writes data at addr of the process.
+// The breakpoint in the range is kept, the written byte becomes its original instruction even if it's disabled.
+func (t *Target) writeMemory(addr uint64, data []byte) error {
+	buf := append([]byte(nil), data...)
+	for _, info := range t.bp.infos {
+		if info.pc >= addr && info.pc < addr+uint64(len(buf)) {
+			info.original = []byte{buf[info.pc-addr]}
+			if info.enabled() {
+				buf[info.pc-addr] = 0xCC
+			}
+		}
+	}
+	_, err := syscall.PtracePokeData(t.cmd.Process.Pid, uintptr(addr), buf)
+	return err
+}
+
+// readUint64 reads the 8 bytes word at addr of the process
+func (t *Target) readUint64(addr uint64) (uint64, error) {
+	buf, err := t.readMemory(addr, 8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+// writeUint64 writes the 8 bytes word at addr of the process
+func (t *Target) writeUint64(addr uint64, value uint64) error {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, value)
+	return t.writeMemory(addr, buf)
 }
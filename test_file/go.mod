@@ -0,0 +1,3 @@
+module test_file
+
+go 1.12
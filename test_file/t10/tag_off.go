@@ -0,0 +1,7 @@
+// +build !godbgtag
+
+package main
+
+func name() string {
+	return "off"
+}
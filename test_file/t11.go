@@ -0,0 +1,24 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+)
+
+func work(n int) int {
+	return n * 2
+}
+
+func main() {
+	var wg sync.WaitGroup
+	results := make([]int, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			runtime.LockOSThread()
+			results[i] = work(i)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+}
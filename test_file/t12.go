@@ -0,0 +1,14 @@
+package main
+
+import "time"
+
+func work(done chan int) {
+	time.Sleep(100 * time.Millisecond)
+	done <- 1
+}
+
+func main() {
+	done := make(chan int)
+	go work(done)
+	<-done
+}
@@ -0,0 +1,50 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+	Name string
+}
+
+type Node struct {
+	Val  int
+	Next *Node
+}
+
+type Shape interface {
+	Area() float64
+}
+
+type Rect struct {
+	W, H float64
+}
+
+func (r Rect) Area() float64 {
+	return r.W * r.H
+}
+
+func main() {
+	i := -42
+	u := uint8(200)
+	f := 3.5
+	c := complex(1.5, -2)
+	b := true
+	r := 'G'
+	s := "hello"
+	p := Point{X: 1, Y: 2, Name: "pt"}
+	pp := &p
+	arr := [3]int{1, 2, 3}
+	sl := []string{"a", "b"}
+	m := map[string]int{"one": 1}
+	ch := make(chan int, 4)
+	ch <- 7
+	var e interface{} = 10
+	var sh Shape = Rect{W: 2, H: 3}
+	fn := fmt.Sprintf
+	n := &Node{Val: 1}
+	n.Next = n
+	var np *Node
+	big, em := make([]int, 200), map[string]int{}
+	fmt.Println(i, u, f, c, b, r, s, p, pp, arr, sl, m, len(ch), e, sh, fn != nil, n != nil, np, len(big), em)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+var counter = 3
+var greeting = "hi"
+
+func sum(a, b int) (total int) {
+	total = a + b
+	x := 1
+	if total > 0 {
+		x := "inner"
+		fmt.Println(x)
+	}
+	y := 2
+	fmt.Println(x, y)
+	return total
+}
+
+func main() {
+	counter++
+	fmt.Println(sum(1, 2), counter, greeting)
+}
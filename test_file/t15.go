@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+//go:noinline
+func scale(p Point, k int) int {
+	r := (p.X + p.Y) * k
+	fmt.Println(r)
+	return r
+}
+
+func main() {
+	fmt.Println(scale(Point{X: 1, Y: 2}, 3))
+}
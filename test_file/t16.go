@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+type Point struct {
+	X, Y int
+}
+
+func (p Point) String() string {
+	return fmt.Sprintf("(%d,%d)", p.X, p.Y)
+}
+
+func (p *Point) Scale(k int) {
+	p.X *= k
+	p.Y *= k
+}
+
+func add(a, b int) int {
+	return a + b
+}
+
+func half(f float64) float64 {
+	return f / 2
+}
+
+func swap(n int, s string) (string, int) {
+	return s, n
+}
+
+func norm(p Point) float64 {
+	return math.Sqrt(float64(p.X*p.X + p.Y*p.Y))
+}
+
+func boom(msg string) int {
+	panic(msg)
+}
+
+func main() {
+	p := Point{X: 3, Y: 4}
+	double := func(n int) int { return n * 2 }
+	fmt.Println(add(1, 2), half(1), norm(p), p.String(), double(1), deep(1))
+	s, n := swap(1, "a")
+	p.Scale(1)
+	fmt.Println(s, n, p)
+	defer func() { recover() }()
+	boom("never")
+}
+
+// deep grows the stack by its large frames
+func deep(n int) int {
+	var buf [1024]byte
+	if n == 0 {
+		return 0
+	}
+	buf[n%len(buf)] = 1
+	return deep(n-1) + int(buf[n%len(buf)])
+}
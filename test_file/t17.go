@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+func leaf(n int) int {
+	return n * 2
+}
+
+func middle(n int) int {
+	return leaf(n+1) + 1
+}
+
+func worker(ch chan int) {
+	ch <- middle(3)
+}
+
+func main() {
+	ch := make(chan int)
+	go worker(ch)
+	fmt.Println(<-ch)
+}
@@ -0,0 +1,16 @@
+package main
+
+/*
+int cadd(int a, int b) {
+	int c = a + b;
+	return c;
+}
+*/
+import "C"
+
+import "fmt"
+
+func main() {
+	sum := C.cadd(1, 2)
+	fmt.Println(sum)
+}
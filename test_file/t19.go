@@ -0,0 +1,20 @@
+package main
+
+import "fmt"
+
+type request struct {
+	id   int
+	path string
+}
+
+func handle(r request) int {
+	return r.id * 2
+}
+
+func main() {
+	sum := 0
+	for i := 0; i < 5; i++ {
+		sum += handle(request{id: i, path: fmt.Sprintf("/r/%d", i)})
+	}
+	fmt.Println(sum)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"test_file/t20/server"
+)
+
+type Server struct {
+	name string
+}
+
+func (s *Server) ServeHTTP(path string) string {
+	return s.name + path
+}
+
+func handler(n int) int {
+	return n + 1
+}
+
+func main() {
+	s := &Server{name: "srv"}
+	fmt.Println(s.ServeHTTP("/a"))
+	fmt.Println(handler(1))
+	fmt.Println(server.Handle(2))
+}
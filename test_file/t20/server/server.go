@@ -0,0 +1,6 @@
+package server
+
+func Handle(n int) int {
+	n *= 3
+	return n
+}
@@ -0,0 +1,25 @@
+package main
+
+import "fmt"
+
+func leaf(n int) int {
+	n *= 2
+	return n + 1
+}
+
+func middle(n int) int {
+	return leaf(n) + leaf(n+1)
+}
+
+//go:noinline
+func top(n int) int {
+	return middle(n) * 2
+}
+
+func main() {
+	sum := 0
+	for i := 0; i < 2; i++ {
+		sum += top(i)
+	}
+	fmt.Println(sum)
+}
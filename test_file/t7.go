@@ -0,0 +1,12 @@
+package main
+
+import "time"
+
+func main() {
+	sum := 0
+	for i := 0; i < 100; i++ {
+		sum += i
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = sum
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+func main() {
+	wd, _ := os.Getwd()
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Printf("args=%v env=%s wd=%s stdin=%s", os.Args[1:], os.Getenv("GODBG_ENV"), wd, line)
+}
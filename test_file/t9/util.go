@@ -0,0 +1,6 @@
+package main
+
+func add(a, b int) int {
+	c := a + b
+	return c
+}
@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	c := add(3, 4)
+	if c != 7 {
+		t.Fatal(c)
+	}
+}
+
+func TestOther(t *testing.T) {
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"sort"
+	"syscall"
+)
+
+// Thread is one thread of the traced process.
+// All threads are stopped when any one of them traps, and resumed together (all-stop).
+type Thread struct {
+	tid int
+	// running is false when the thread is stopped by ptrace
+	running bool
+	// pendingSig is the signal received while stopping, it is delivered when the thread is resumed
+	pendingSig syscall.Signal
+}
+
+// initThreads builds the thread table from the stopped threads, and traces the threads created later
+func (t *Target) initThreads(tids []int) error {
+	t.threads = make(map[int]*Thread, len(tids))
+	for _, tid := range tids {
+		if err := syscall.PtraceSetOptions(tid, syscall.PTRACE_O_TRACECLONE); err != nil {
+			logger.Error("initThreads:PtraceSetOptions", zap.Error(err), zap.Int("tid", tid))
+			return err
+		}
+		t.threads[tid] = &Thread{tid: tid}
+	}
+	t.curThread = t.threads[t.cmd.Process.Pid]
+	if t.curThread == nil && len(tids) > 0 {
+		t.curThread = t.threads[tids[0]]
+	}
+	// the addresses of position-independent executable are known after the process is loaded
+	return t.loadStaticBase(t.cmd.Process.Pid)
+}
+
+// curTid return the thread whose registers are read and written, it is the process itself without thread table.
+func (t *Target) curTid() int {
+	if t.curThread != nil {
+		return t.curThread.tid
+	}
+	return t.cmd.Process.Pid
+}
+
+// sortedThreads return all threads ordered by tid
+func (t *Target) sortedThreads() []*Thread {
+	threads := make([]*Thread, 0, len(t.threads))
+	for _, thread := range t.threads {
+		threads = append(threads, thread)
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i].tid < threads[j].tid })
+	return threads
+}
+
+// switchThread changes the current thread.
+// The pc of the old thread is moved back if it traps on breakpoint, because only the current thread steps over breakpoint.
+func (t *Target) switchThread(tid int) error {
+	thread, ok := t.threads[tid]
+	if !ok {
+		return fmt.Errorf("can't find thread %d", tid)
+	}
+	if t.curThread != nil && t.curThread != thread {
+		if err := t.rewindBreakPoint(t.curThread.tid); err != nil {
+			return err
+		}
+	}
+	t.curThread = thread
+	t.curFrame = 0
+	return nil
+}
+
+// addThread is called when a new thread is cloned, the new thread is traced automatically and starts with SIGSTOP
+func (t *Target) addThread(tid int) *Thread {
+	if thread, ok := t.threads[tid]; ok {
+		return thread
+	}
+	logger.Debug("addThread", zap.Int("tid", tid))
+	thread := &Thread{tid: tid, running: true}
+	t.threads[tid] = thread
+	return thread
+}
+
+// removeThread is called when a thread exits
+func (t *Target) removeThread(tid int) {
+	delete(t.threads, tid)
+	if t.curThread != nil && t.curThread.tid == tid {
+		t.curThread = t.threads[t.cmd.Process.Pid]
+	}
+}
+
+// resumeAllThreads continues every stopped thread with its pending signal
+func (t *Target) resumeAllThreads() error {
+	t.curGoroutine, t.curFrame = nil, 0
+	for _, thread := range t.threads {
+		if thread.running {
+			continue
+		}
+		err := syscall.PtraceCont(thread.tid, int(thread.pendingSig))
+		// the thread is killed when another resumed thread exits the process, its exit is reaped by waitTrap
+		if err != nil && err != syscall.ESRCH {
+			logger.Error("resumeAllThreads:PtraceCont", zap.Error(err), zap.Int("tid", thread.tid))
+			return err
+		}
+		thread.pendingSig = 0
+		thread.running = true
+	}
+	return nil
+}
+
+// handleCloneEvent adds the new thread when the status is PTRACE_EVENT_CLONE.
+func (t *Target) handleCloneEvent(tid int, s syscall.WaitStatus) (bool, error) {
+	if !s.Stopped() || s.StopSignal() != syscall.SIGTRAP || s.TrapCause() != syscall.PTRACE_EVENT_CLONE {
+		return false, nil
+	}
+	newtid, err := syscall.PtraceGetEventMsg(tid)
+	if err != nil {
+		return true, err
+	}
+	t.addThread(int(newtid))
+	return true, nil
+}
+
+// waitTrap waits until one thread traps, then stops all the other threads.
+// The other signals are delivered to the threads, it returns exited = true when the process has exited.
+func (t *Target) waitTrap() (int, bool, error) {
+	pid := t.cmd.Process.Pid
+	for {
+		var s syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &s, syscall.WALL, nil)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if s.Exited() || s.Signaled() {
+			t.removeThread(wpid)
+			if wpid == pid {
+				return wpid, true, nil
+			}
+			continue
+		}
+		if !s.Stopped() {
+			continue
+		}
+
+		thread := t.addThread(wpid)
+		thread.running = false
+		if isClone, err := t.handleCloneEvent(wpid, s); isClone {
+			if err != nil {
+				return 0, false, err
+			}
+			if err = syscall.PtraceCont(wpid, 0); err != nil {
+				return 0, false, err
+			}
+			thread.running = true
+			continue
+		}
+
+		switch sig := s.StopSignal(); sig {
+		case syscall.SIGTRAP:
+			t.curThread = thread
+			if err = t.stopAllThreads(); err != nil {
+				return 0, false, err
+			}
+			return wpid, false, nil
+		case syscall.SIGSTOP:
+			// the new thread starts with SIGSTOP, or the SIGSTOP sent by stopAllThreads arrives late
+			err = syscall.PtraceCont(wpid, 0)
+		default:
+			err = syscall.PtraceCont(wpid, int(sig))
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		thread.running = true
+	}
+}
+
+// stopAllThreads stops every running thread by SIGSTOP.
+// If a thread traps on breakpoint meanwhile, its pc is moved back to the breakpoint, so it traps again after resumed.
+func (t *Target) stopAllThreads() error {
+	pid := t.cmd.Process.Pid
+	for {
+		var running *Thread
+		for _, thread := range t.threads {
+			if thread.running {
+				running = thread
+				break
+			}
+		}
+		if running == nil {
+			return nil
+		}
+
+		if err := syscall.Tgkill(pid, running.tid, syscall.SIGSTOP); err != nil {
+			if err == syscall.ESRCH {
+				t.removeThread(running.tid)
+				continue
+			}
+			return err
+		}
+		for running.running {
+			var s syscall.WaitStatus
+			wpid, err := syscall.Wait4(running.tid, &s, syscall.WALL, nil)
+			if err != nil {
+				if err == syscall.ECHILD {
+					t.removeThread(running.tid)
+					break
+				}
+				return err
+			}
+			if s.Exited() || s.Signaled() {
+				t.removeThread(wpid)
+				break
+			}
+			if !s.Stopped() {
+				continue
+			}
+			if isClone, err := t.handleCloneEvent(wpid, s); isClone {
+				// the new thread will be stopped in the next round, keep waiting for SIGSTOP
+				if err != nil {
+					return err
+				}
+				if err = syscall.PtraceCont(wpid, 0); err != nil {
+					return err
+				}
+				continue
+			}
+			running.running = false
+			switch sig := s.StopSignal(); sig {
+			case syscall.SIGSTOP:
+			case syscall.SIGTRAP:
+				if err = t.rewindBreakPoint(wpid); err != nil {
+					return err
+				}
+			default:
+				running.pendingSig = sig
+			}
+		}
+	}
+}
+
+// rewindBreakPoint moves the pc of thread back when it traps on the breakpoint
+func (t *Target) rewindBreakPoint(tid int) error {
+	var regs syscall.PtraceRegs
+	if err := syscall.PtraceGetRegs(tid, &regs); err != nil {
+		return err
+	}
+	if _, ok := t.bp.findBreakPoint(regs.PC() - 1); !ok {
+		return nil
+	}
+	regs.SetPC(regs.PC() - 1)
+	return syscall.PtraceSetRegs(tid, &regs)
+}
+
+// stepThread executes one instruction of the thread while the others keep stopped.
+// It returns exited = true when the process has exited.
+func (t *Target) stepThread(tid int) (bool, error) {
+	pid := t.cmd.Process.Pid
+	thread, ok := t.threads[tid]
+	if !ok {
+		thread = &Thread{tid: tid}
+	}
+	t.curGoroutine, t.curFrame = nil, 0
+	for {
+		if err := syscall.PtraceSingleStep(tid); err != nil {
+			return false, err
+		}
+		var s syscall.WaitStatus
+		if _, err := syscall.Wait4(tid, &s, syscall.WALL, nil); err != nil {
+			return false, err
+		}
+		if s.Exited() || s.Signaled() {
+			t.removeThread(tid)
+			if tid == pid {
+				return true, nil
+			}
+			return false, fmt.Errorf("thread %d has exited", tid)
+		}
+		if !s.Stopped() {
+			return false, fmt.Errorf("unknown waitstatus %v, signal %d", s, s.Signal())
+		}
+		// the new thread is created by the stepped instruction, stop it too.
+		// The clone syscall isn't finished yet, so the step goes on until it traps
+		if isClone, err := t.handleCloneEvent(tid, s); isClone {
+			if err != nil {
+				return false, err
+			}
+			if err = t.stopAllThreads(); err != nil {
+				return false, err
+			}
+			continue
+		}
+		switch sig := s.StopSignal(); sig {
+		case syscall.SIGTRAP:
+			return false, nil
+		case syscall.SIGSTOP:
+		default:
+			// the instruction isn't executed, deliver the signal when the thread is resumed
+			thread.pendingSig = sig
+		}
+	}
+}
+
+// detachAllThreads releases every thread of the process
+func (t *Target) detachAllThreads() error {
+	if len(t.threads) == 0 {
+		return errors.New("there is no thread traced")
+	}
+	for _, thread := range t.threads {
+		if err := syscall.PtraceDetach(thread.tid); err != nil {
+			logger.Error("detachAllThreads:PtraceDetach", zap.Error(err), zap.Int("tid", thread.tid))
+			return err
+		}
+	}
+	t.threads = nil
+	t.curThread = nil
+	return nil
+}
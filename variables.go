@@ -0,0 +1,845 @@
+package main
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"go/constant"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// LoadConfig limits the data read by print, it protects against huge or cyclic data
+type LoadConfig struct {
+	// MaxDepth is the max nesting of pointers, structs, arrays, maps ... which are expanded
+	MaxDepth int
+	// MaxArrayLength is the max elements read from array, slice, map and channel
+	MaxArrayLength int
+	// MaxStringLength is the max bytes read from string
+	MaxStringLength int
+}
+
+func defaultLoadConfig() LoadConfig {
+	return LoadConfig{MaxDepth: 3, MaxArrayLength: 64, MaxStringLength: 64}
+}
+
+// loadConfig is changed by `config`
+var loadConfig = defaultLoadConfig()
+
+// Variable is the value of DWARF type at addr of the process
+type Variable struct {
+	name string
+	addr uint64
+	typ  dwarf.Type
+	// data is the value which isn't in memory, the value is read from memory at addr when data is nil
+	data []byte
+	// value is the untyped constant of expression like `1 + 2`, typ is nil
+	value constant.Value
+}
+
+func newVariable(name string, addr uint64, typ dwarf.Type) *Variable {
+	return &Variable{name: name, addr: addr, typ: typ}
+}
+
+// bytes return the value of variable
+func (v *Variable) bytes() ([]byte, error) {
+	size := v.typ.Size()
+	if size < 0 {
+		return nil, fmt.Errorf("unknown size of type %s", typeName(v.typ))
+	}
+	if v.data != nil {
+		if int64(len(v.data)) < size {
+			return nil, fmt.Errorf("short data of type %s", typeName(v.typ))
+		}
+		return v.data[:size], nil
+	}
+	return target.readMemory(v.addr, int(size))
+}
+
+// child return the part of variable at offset, like the field of struct
+func (v *Variable) child(name string, offset int64, typ dwarf.Type) *Variable {
+	child := newVariable(name, v.addr+uint64(offset), typ)
+	if v.data != nil && offset+typ.Size() <= int64(len(v.data)) {
+		child.data = v.data[offset : offset+typ.Size()]
+	}
+	return child
+}
+
+// uintField reads the unsigned integer field of struct variable
+func (v *Variable) uintField(name string) (uint64, error) {
+	st, ok := resolveTypedef(v.typ).(*dwarf.StructType)
+	if !ok {
+		return 0, fmt.Errorf("%s isn't struct", typeName(v.typ))
+	}
+	field, err := structField(st, name)
+	if err != nil {
+		return 0, err
+	}
+	return v.child(name, field.ByteOffset, field.Type).uint()
+}
+
+// uint reads the integer or pointer variable
+func (v *Variable) uint() (uint64, error) {
+	buf, err := v.bytes()
+	if err != nil {
+		return 0, err
+	}
+	switch len(buf) {
+	case 1:
+		return uint64(buf[0]), nil
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(buf)), nil
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(buf)), nil
+	case 8:
+		return binary.LittleEndian.Uint64(buf), nil
+	}
+	return 0, fmt.Errorf("unsupported size %d of type %s", len(buf), typeName(v.typ))
+}
+
+// int reads the signed integer variable
+func (v *Variable) int() (int64, error) {
+	n, err := v.uint()
+	if err != nil {
+		return 0, err
+	}
+	switch v.typ.Size() {
+	case 1:
+		return int64(int8(n)), nil
+	case 2:
+		return int64(int16(n)), nil
+	case 4:
+		return int64(int32(n)), nil
+	}
+	return int64(n), nil
+}
+
+// typeName return the name of type in go syntax
+func typeName(typ dwarf.Type) string {
+	if name := typ.Common().Name; name != "" {
+		return name
+	}
+	if st, ok := typ.(*dwarf.StructType); ok && st.StructName != "" {
+		return st.StructName
+	}
+	return typ.String()
+}
+
+// format return the value of variable like `main.Point {X: 1, Y: 2}`
+func (v *Variable) format(cfg LoadConfig) string {
+	var b strings.Builder
+	v.writeValue(&b, cfg, 0, true)
+	return b.String()
+}
+
+// writeValue writes the value of variable, the type name is omitted when showType is false.
+// The pointers, structs, arrays and maps deeper than cfg.MaxDepth aren't expanded.
+func (v *Variable) writeValue(b *strings.Builder, cfg LoadConfig, depth int, showType bool) {
+	var err error
+	if v.typ == nil && v.value != nil {
+		if v.value.Kind() == constant.String {
+			b.WriteString(strconv.Quote(constant.StringVal(v.value)))
+		} else {
+			b.WriteString(v.value.String())
+		}
+		return
+	}
+	switch typ := resolveTypedef(v.typ).(type) {
+	case *dwarf.BoolType, *dwarf.IntType, *dwarf.UintType, *dwarf.CharType, *dwarf.UcharType,
+		*dwarf.FloatType, *dwarf.ComplexType:
+		err = v.writeBasic(b)
+	case *dwarf.PtrType:
+		st, _ := resolveTypedef(typ.Type).(*dwarf.StructType)
+		switch {
+		case mapKind(v.typ) != "":
+			err = v.writeMap(b, cfg, depth, showType)
+		case st != nil && strings.HasPrefix(st.StructName, "hchan<"):
+			err = v.writeChan(b, cfg, depth, showType)
+		default:
+			err = v.writePointer(b, cfg, depth)
+		}
+	case *dwarf.StructType:
+		switch {
+		case typ.StructName == "string":
+			err = v.writeString(b, cfg)
+		case strings.HasPrefix(typ.StructName, "[]"):
+			err = v.writeSlice(b, cfg, depth, showType)
+		case typ.StructName == "runtime.eface" || typ.StructName == "runtime.iface":
+			err = v.writeInterface(b, cfg, depth, typ)
+		default:
+			err = v.writeStruct(b, cfg, depth, showType, typ)
+		}
+	case *dwarf.ArrayType:
+		if showType {
+			fmt.Fprintf(b, "%s ", typeName(v.typ))
+		}
+		err = v.writeElements(b, cfg, depth, v, typ.Count, typ.Type)
+	case *dwarf.FuncType:
+		err = v.writeFunc(b)
+	default:
+		fmt.Fprintf(b, "(unsupported type %s)", typeName(v.typ))
+	}
+	if err != nil {
+		fmt.Fprintf(b, "(unreadable %s)", err.Error())
+	}
+}
+
+func (v *Variable) writeBasic(b *strings.Builder) error {
+	buf, err := v.bytes()
+	if err != nil {
+		return err
+	}
+	switch typ := resolveTypedef(v.typ).(type) {
+	case *dwarf.BoolType:
+		b.WriteString(strconv.FormatBool(buf[0] != 0))
+	case *dwarf.IntType, *dwarf.CharType:
+		n, err := v.int()
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.FormatInt(n, 10))
+		// rune is int32
+		if typ.Size() == 4 && n > 0 && n <= unicode.MaxRune && unicode.IsPrint(rune(n)) {
+			fmt.Fprintf(b, " %q", rune(n))
+		}
+	case *dwarf.UintType, *dwarf.UcharType:
+		n, err := v.uint()
+		if err != nil {
+			return err
+		}
+		b.WriteString(strconv.FormatUint(n, 10))
+	case *dwarf.FloatType:
+		b.WriteString(formatFloat(buf))
+	case *dwarf.ComplexType:
+		if len(buf) == 8 {
+			fmt.Fprint(b, complex(math.Float32frombits(binary.LittleEndian.Uint32(buf)), math.Float32frombits(binary.LittleEndian.Uint32(buf[4:]))))
+		} else {
+			fmt.Fprint(b, complex(math.Float64frombits(binary.LittleEndian.Uint64(buf)), math.Float64frombits(binary.LittleEndian.Uint64(buf[8:]))))
+		}
+	}
+	return nil
+}
+
+func formatFloat(buf []byte) string {
+	if len(buf) == 4 {
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(buf))), 'g', -1, 32)
+	}
+	return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(buf)), 'g', -1, 64)
+}
+
+func (v *Variable) writePointer(b *strings.Builder, cfg LoadConfig, depth int) error {
+	addr, err := v.uint()
+	if err != nil {
+		return err
+	}
+	elem := resolveTypedef(v.typ).(*dwarf.PtrType).Type
+	if _, ok := elem.(*dwarf.VoidType); ok || elem == nil {
+		fmt.Fprintf(b, "unsafe.Pointer(0x%x)", addr)
+		return nil
+	}
+	if addr == 0 {
+		fmt.Fprintf(b, "%s nil", typeName(v.typ))
+		return nil
+	}
+	if depth >= cfg.MaxDepth {
+		fmt.Fprintf(b, "(%s)(0x%x)", typeName(v.typ), addr)
+		return nil
+	}
+	b.WriteString("*")
+	newVariable("", addr, elem).writeValue(b, cfg, depth+1, true)
+	return nil
+}
+
+func (v *Variable) writeString(b *strings.Builder, cfg LoadConfig) error {
+	addr, err := v.uintField("str")
+	if err != nil {
+		return err
+	}
+	length, err := v.uintField("len")
+	if err != nil {
+		return err
+	}
+	if int64(length) < 0 {
+		return fmt.Errorf("invalid length %d of string", int64(length))
+	}
+	n := length
+	if n > uint64(cfg.MaxStringLength) {
+		n = uint64(cfg.MaxStringLength)
+	}
+	buf, err := target.readMemory(addr, int(n))
+	if err != nil {
+		return err
+	}
+	b.WriteString(strconv.Quote(string(buf)))
+	if n < length {
+		fmt.Fprintf(b, "...+%d more", length-n)
+	}
+	return nil
+}
+
+func (v *Variable) writeSlice(b *strings.Builder, cfg LoadConfig, depth int, showType bool) error {
+	st := resolveTypedef(v.typ).(*dwarf.StructType)
+	array, err := structField(st, "array")
+	if err != nil {
+		return err
+	}
+	addr, err := v.uintField("array")
+	if err != nil {
+		return err
+	}
+	length, err := v.uintField("len")
+	if err != nil {
+		return err
+	}
+	capacity, err := v.uintField("cap")
+	if err != nil {
+		return err
+	}
+	if showType {
+		fmt.Fprintf(b, "%s ", typeName(v.typ))
+	}
+	if addr == 0 {
+		b.WriteString("nil")
+		return nil
+	}
+	fmt.Fprintf(b, "len: %d, cap: %d, ", length, capacity)
+	elem := resolveTypedef(array.Type).(*dwarf.PtrType).Type
+	return v.writeElements(b, cfg, depth, newVariable("", addr, elem), int64(length), elem)
+}
+
+// writeElements writes `[e0,e1,...]`, the elements are stored continuously from base
+func (v *Variable) writeElements(b *strings.Builder, cfg LoadConfig, depth int, base *Variable, length int64, elem dwarf.Type) error {
+	if depth >= cfg.MaxDepth && length > 0 {
+		b.WriteString("[...]")
+		return nil
+	}
+	b.WriteString("[")
+	for i := int64(0); i < length; i++ {
+		if i >= int64(cfg.MaxArrayLength) {
+			fmt.Fprintf(b, "...+%d more", length-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		base.child("", i*elem.Size(), elem).writeValue(b, cfg, depth+1, false)
+	}
+	b.WriteString("]")
+	return nil
+}
+
+func (v *Variable) writeStruct(b *strings.Builder, cfg LoadConfig, depth int, showType bool, st *dwarf.StructType) error {
+	if showType {
+		fmt.Fprintf(b, "%s ", typeName(v.typ))
+	}
+	if depth >= cfg.MaxDepth && len(st.Field) > 0 {
+		b.WriteString("{...}")
+		return nil
+	}
+	b.WriteString("{")
+	for i, field := range st.Field {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(b, "%s: ", field.Name)
+		v.child(field.Name, field.ByteOffset, field.Type).writeValue(b, cfg, depth+1, true)
+	}
+	b.WriteString("}")
+	return nil
+}
+
+// writeInterface writes the value of dynamic type, it's found by the address of `runtime._type`
+func (v *Variable) writeInterface(b *strings.Builder, cfg LoadConfig, depth int, st *dwarf.StructType) error {
+	var (
+		rtype uint64
+		err   error
+	)
+	data, err := v.uintField("data")
+	if err != nil {
+		return err
+	}
+	if st.StructName == "runtime.eface" {
+		rtype, err = v.uintField("_type")
+	} else {
+		rtype, err = v.itabType()
+	}
+	if err != nil {
+		return err
+	}
+	if rtype == 0 {
+		fmt.Fprintf(b, "%s nil", typeName(v.typ))
+		return nil
+	}
+	dynamicType, err := target.bi.runtimeTypeToDwarf(rtype)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "%s(%s) ", typeName(v.typ), typeName(dynamicType))
+
+	value := newVariable("", data, dynamicType)
+	// the pointer shaped value is stored in the data word directly
+	if isDirectIface(dynamicType) {
+		value.data = make([]byte, 8)
+		binary.LittleEndian.PutUint64(value.data, data)
+	}
+	value.writeValue(b, cfg, depth, false)
+	return nil
+}
+
+// itabType reads `iface.tab._type`
+func (v *Variable) itabType() (uint64, error) {
+	st := resolveTypedef(v.typ).(*dwarf.StructType)
+	tabField, err := structField(st, "tab")
+	if err != nil {
+		return 0, err
+	}
+	tab, err := v.uintField("tab")
+	if err != nil || tab == 0 {
+		return 0, err
+	}
+	itab, ok := resolveTypedef(resolveTypedef(tabField.Type).(*dwarf.PtrType).Type).(*dwarf.StructType)
+	if !ok {
+		return 0, fmt.Errorf("unexpected type %s of itab", tabField.Type)
+	}
+	// it's `internal/abi.ITab.Type` since go1.22, `runtime.itab._type` before
+	typField, err := structField(itab, "Type")
+	if err != nil {
+		if typField, err = structField(itab, "_type"); err != nil {
+			return 0, err
+		}
+	}
+	return newVariable("", tab, itab).child("", typField.ByteOffset, typField.Type).uint()
+}
+
+// isDirectIface reports whether the value of type is stored in the data word of interface
+func isDirectIface(typ dwarf.Type) bool {
+	switch typ := resolveTypedef(typ).(type) {
+	case *dwarf.PtrType, *dwarf.FuncType:
+		return true
+	case *dwarf.StructType:
+		return len(typ.Field) == 1 && typ.StructName != "string" && isDirectIface(typ.Field[0].Type)
+	case *dwarf.ArrayType:
+		return typ.Count == 1 && isDirectIface(typ.Type)
+	}
+	return false
+}
+
+// writeFunc writes the name of function, the func value points to `runtime.funcval` whose first word is the pc
+func (v *Variable) writeFunc(b *strings.Builder) error {
+	addr, err := v.uint()
+	if err != nil {
+		return err
+	}
+	if addr == 0 {
+		fmt.Fprintf(b, "%s nil", typeName(v.typ))
+		return nil
+	}
+	pc, err := target.readUint64(addr)
+	if err != nil {
+		return err
+	}
+	f, err := target.bi.findFunctionIncludePc(pc)
+	if err != nil {
+		return err
+	}
+	b.WriteString(f.name)
+	return nil
+}
+
+func (v *Variable) writeChan(b *strings.Builder, cfg LoadConfig, depth int, showType bool) error {
+	if showType {
+		fmt.Fprintf(b, "%s ", typeName(v.typ))
+	}
+	addr, err := v.uint()
+	if err != nil {
+		return err
+	}
+	if addr == 0 {
+		b.WriteString("nil")
+		return nil
+	}
+	hchan := newVariable("", addr, resolveTypedef(v.typ).(*dwarf.PtrType).Type)
+	qcount, err := hchan.uintField("qcount")
+	if err != nil {
+		return err
+	}
+	dataqsiz, err := hchan.uintField("dataqsiz")
+	if err != nil {
+		return err
+	}
+	buf, err := hchan.uintField("buf")
+	if err != nil {
+		return err
+	}
+	recvx, err := hchan.uintField("recvx")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "len: %d, cap: %d", qcount, dataqsiz)
+
+	// the element type is only described by `hchan<T>.recvq.first.elem`, which is *T
+	elem, err := chanElemType(resolveTypedef(hchan.typ).(*dwarf.StructType))
+	if err != nil || qcount == 0 {
+		return nil
+	}
+	if depth >= cfg.MaxDepth {
+		b.WriteString(", [...]")
+		return nil
+	}
+	b.WriteString(", [")
+	for i := uint64(0); i < qcount; i++ {
+		if i >= uint64(cfg.MaxArrayLength) {
+			fmt.Fprintf(b, "...+%d more", qcount-i)
+			break
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		index := (recvx + i) % dataqsiz
+		newVariable("", buf+index*uint64(elem.Size()), elem).writeValue(b, cfg, depth+1, false)
+	}
+	b.WriteString("]")
+	return nil
+}
+
+func chanElemType(hchan *dwarf.StructType) (dwarf.Type, error) {
+	typ := dwarf.Type(hchan)
+	for _, name := range []string{"recvq", "first", "elem"} {
+		st, ok := resolveTypedef(typ).(*dwarf.StructType)
+		if !ok {
+			ptr, ok := resolveTypedef(typ).(*dwarf.PtrType)
+			if !ok {
+				return nil, fmt.Errorf("unexpected type %s of channel", hchan.StructName)
+			}
+			if st, ok = resolveTypedef(ptr.Type).(*dwarf.StructType); !ok {
+				return nil, fmt.Errorf("unexpected type %s of channel", hchan.StructName)
+			}
+		}
+		field, err := structField(st, name)
+		if err != nil {
+			return nil, err
+		}
+		typ = field.Type
+	}
+	ptr, ok := resolveTypedef(typ).(*dwarf.PtrType)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %s of channel", hchan.StructName)
+	}
+	return ptr.Type, nil
+}
+
+// mapKind return the name of runtime map struct, `map<K,V>` since go1.24 or `hash<K,V>` before, it's empty for other types
+func mapKind(typ dwarf.Type) string {
+	ptr, ok := resolveTypedef(typ).(*dwarf.PtrType)
+	if !ok {
+		return ""
+	}
+	st, ok := resolveTypedef(ptr.Type).(*dwarf.StructType)
+	if !ok {
+		return ""
+	}
+	if strings.HasPrefix(st.StructName, "map<") || strings.HasPrefix(st.StructName, "hash<") {
+		return st.StructName
+	}
+	return ""
+}
+
+// mapLen return the count of entries, the nil map returns nil hmap
+func (v *Variable) mapLen() (*Variable, uint64, error) {
+	addr, err := v.uint()
+	if err != nil || addr == 0 {
+		return nil, 0, err
+	}
+	hmap := newVariable("", addr, resolveTypedef(v.typ).(*dwarf.PtrType).Type)
+	field := "used"
+	if strings.HasPrefix(mapKind(v.typ), "hash<") {
+		field = "count"
+	}
+	count, err := hmap.uintField(field)
+	if err != nil {
+		return nil, 0, err
+	}
+	return hmap, count, nil
+}
+
+// walkMap calls fn with every entry of map until fn returns false
+func (v *Variable) walkMap(fn func(key, value *Variable) bool) error {
+	hmap, _, err := v.mapLen()
+	if hmap == nil || err != nil {
+		return err
+	}
+	if strings.HasPrefix(mapKind(v.typ), "hash<") {
+		return walkHashMap(hmap, fn)
+	}
+	return walkSwissMap(hmap, fn)
+}
+
+func (v *Variable) writeMap(b *strings.Builder, cfg LoadConfig, depth int, showType bool) error {
+	if showType {
+		fmt.Fprintf(b, "%s ", typeName(v.typ))
+	}
+	hmap, total, err := v.mapLen()
+	if err != nil {
+		return err
+	}
+	if hmap == nil {
+		b.WriteString("nil")
+		return nil
+	}
+	fmt.Fprintf(b, "len: %d, ", total)
+	if depth >= cfg.MaxDepth && total > 0 {
+		b.WriteString("[...]")
+		return nil
+	}
+
+	b.WriteString("[")
+	count := uint64(0)
+	err = v.walkMap(func(key, value *Variable) bool {
+		if count >= uint64(cfg.MaxArrayLength) {
+			return false
+		}
+		if count > 0 {
+			b.WriteString(", ")
+		}
+		key.writeValue(b, cfg, depth+1, false)
+		b.WriteString(": ")
+		value.writeValue(b, cfg, depth+1, false)
+		count++
+		return true
+	})
+	if count < total {
+		if count > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(b, "...+%d more", total-count)
+	}
+	b.WriteString("]")
+	return err
+}
+
+// walkSwissMap walks `internal/runtime/maps.Map` since go1.24.
+// The small map has no directory, dirPtr points to the only group; otherwise dirPtr points to dirLen tables.
+func walkSwissMap(m *Variable, fn func(key, value *Variable) bool) error {
+	dirPtr, err := m.uintField("dirPtr")
+	if err != nil {
+		return err
+	}
+	dirLen, err := m.uintField("dirLen")
+	if err != nil {
+		return err
+	}
+	tableType, groupType, err := swissMapTypes(resolveTypedef(m.typ).(*dwarf.StructType))
+	if err != nil {
+		return err
+	}
+	// the empty map made by NewEmptyMap has no group
+	if dirPtr == 0 {
+		return nil
+	}
+	if dirLen == 0 {
+		_, err = walkSwissGroup(newVariable("", dirPtr, groupType), fn)
+		return err
+	}
+
+	visited := make(map[uint64]bool)
+	for i := uint64(0); i < dirLen; i++ {
+		tableAddr, err := target.readUint64(dirPtr + i*8)
+		if err != nil {
+			return err
+		}
+		// the tables are shared by the directory entries
+		if visited[tableAddr] {
+			continue
+		}
+		visited[tableAddr] = true
+		table := newVariable("", tableAddr, tableType)
+		groupsField, err := structField(tableType, "groups")
+		if err != nil {
+			return err
+		}
+		groups := table.child("groups", groupsField.ByteOffset, groupsField.Type)
+		data, err := groups.uintField("data")
+		if err != nil {
+			return err
+		}
+		lengthMask, err := groups.uintField("lengthMask")
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j <= lengthMask; j++ {
+			more, err := walkSwissGroup(newVariable("", data+j*uint64(groupType.Size()), groupType), fn)
+			if err != nil || !more {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// swissMapTypes finds table<K,V> and group of map<K,V>
+func swissMapTypes(m *dwarf.StructType) (*dwarf.StructType, *dwarf.StructType, error) {
+	dirPtr, err := structField(m, "dirPtr")
+	if err != nil {
+		return nil, nil, err
+	}
+	typ := dirPtr.Type
+	for i := 0; i < 2; i++ {
+		ptr, ok := resolveTypedef(typ).(*dwarf.PtrType)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected type %s of %s.dirPtr", dirPtr.Type, m.StructName)
+		}
+		typ = ptr.Type
+	}
+	table, ok := resolveTypedef(typ).(*dwarf.StructType)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected type %s of %s.dirPtr", dirPtr.Type, m.StructName)
+	}
+	groups, err := structField(table, "groups")
+	if err != nil {
+		return nil, nil, err
+	}
+	groupsType, ok := resolveTypedef(groups.Type).(*dwarf.StructType)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected type %s of groups", groups.Type)
+	}
+	data, err := structField(groupsType, "data")
+	if err != nil {
+		return nil, nil, err
+	}
+	ptr, ok := resolveTypedef(data.Type).(*dwarf.PtrType)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected type %s of groups.data", data.Type)
+	}
+	group, ok := resolveTypedef(ptr.Type).(*dwarf.StructType)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected type %s of group", ptr.Type)
+	}
+	return table, group, nil
+}
+
+// walkSwissGroup walks the full slots of group, the slot is full when the high bit of its control byte is 0
+func walkSwissGroup(group *Variable, fn func(key, value *Variable) bool) (bool, error) {
+	st := resolveTypedef(group.typ).(*dwarf.StructType)
+	ctrl, err := group.uintField("ctrl")
+	if err != nil {
+		return false, err
+	}
+	slotsField, err := structField(st, "slots")
+	if err != nil {
+		return false, err
+	}
+	slots, ok := resolveTypedef(slotsField.Type).(*dwarf.ArrayType)
+	if !ok {
+		return false, fmt.Errorf("unexpected type %s of slots", slotsField.Type)
+	}
+	slotType, ok := resolveTypedef(slots.Type).(*dwarf.StructType)
+	if !ok {
+		return false, fmt.Errorf("unexpected type %s of slot", slots.Type)
+	}
+	keyField, err := structField(slotType, "key")
+	if err != nil {
+		return false, err
+	}
+	elemField, err := structField(slotType, "elem")
+	if err != nil {
+		return false, err
+	}
+	for i := int64(0); i < slots.Count; i++ {
+		if (ctrl>>(8*uint(i)))&0x80 != 0 {
+			continue
+		}
+		slot := group.child("", slotsField.ByteOffset+i*slotType.Size(), slotType)
+		if !fn(slot.child("key", keyField.ByteOffset, keyField.Type), slot.child("elem", elemField.ByteOffset, elemField.Type)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// walkHashMap walks `runtime.hmap` before go1.24, the buckets are chained by overflow
+func walkHashMap(hmap *Variable, fn func(key, value *Variable) bool) error {
+	st := resolveTypedef(hmap.typ).(*dwarf.StructType)
+	bucketsField, err := structField(st, "buckets")
+	if err != nil {
+		return err
+	}
+	ptr, ok := resolveTypedef(bucketsField.Type).(*dwarf.PtrType)
+	if !ok {
+		return fmt.Errorf("unexpected type %s of buckets", bucketsField.Type)
+	}
+	bucketType, ok := resolveTypedef(ptr.Type).(*dwarf.StructType)
+	if !ok {
+		return fmt.Errorf("unexpected type %s of bucket", ptr.Type)
+	}
+	B, err := hmap.uintField("B")
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{"oldbuckets", "buckets"} {
+		buckets, err := hmap.uintField(name)
+		if err != nil {
+			return err
+		}
+		if buckets == 0 {
+			continue
+		}
+		n := uint64(1) << B
+		if name == "oldbuckets" && B > 0 {
+			n = n >> 1
+		}
+		for i := uint64(0); i < n; i++ {
+			for bucket := buckets + i*uint64(bucketType.Size()); bucket != 0; {
+				more, err := walkHashBucket(newVariable("", bucket, bucketType), fn)
+				if err != nil || !more {
+					return err
+				}
+				if bucket, err = newVariable("", bucket, bucketType).uintField("overflow"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// walkHashBucket walks the entries of bucket, the tophash less than minTopHash means empty or evacuated
+func walkHashBucket(bucket *Variable, fn func(key, value *Variable) bool) (bool, error) {
+	const minTopHash = 5
+	st := resolveTypedef(bucket.typ).(*dwarf.StructType)
+	tophash, err := bucket.fieldBytes(st, "tophash")
+	if err != nil {
+		return false, err
+	}
+	keysField, err := structField(st, "keys")
+	if err != nil {
+		return false, err
+	}
+	valuesField, err := structField(st, "values")
+	if err != nil {
+		return false, err
+	}
+	keyType := resolveTypedef(keysField.Type).(*dwarf.ArrayType).Type
+	valueType := resolveTypedef(valuesField.Type).(*dwarf.ArrayType).Type
+	for i, h := range tophash {
+		if h < minTopHash {
+			continue
+		}
+		key := bucket.child("", keysField.ByteOffset+int64(i)*keyType.Size(), keyType)
+		value := bucket.child("", valuesField.ByteOffset+int64(i)*valueType.Size(), valueType)
+		if !fn(key, value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// fieldBytes reads the raw bytes of struct field
+func (v *Variable) fieldBytes(st *dwarf.StructType, name string) ([]byte, error) {
+	field, err := structField(st, name)
+	if err != nil {
+		return nil, err
+	}
+	return v.child(name, field.ByteOffset, field.Type).bytes()
+}